@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Источники - первые стадии конвейера, отдающие элементы из внешнего мира.
+// Все они прекращают работу, когда конвейер начинает останавливаться (см. Stopping).
+// Источники и приемники с вводом-выводом запоминают первую ошибку, ее отдает Err после Run
+
+type adapterErr struct {
+	mu  sync.Mutex
+	err error
+}
+
+func (a *adapterErr) setErr(err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.err == nil {
+		a.err = err
+	}
+}
+
+func (a *adapterErr) Err() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.err
+}
+
+// send отдает элемент в конвейер, если тот еще не останавливается
+func send(out chan interface{}, item interface{}) bool {
+	select {
+	case out <- item:
+		return true
+	case <-Stopping(out):
+		return false
+	}
+}
+
+// readLines отдает непустые строки r. Если конвейер останавливают, пока r ждет данных
+// (stdin без ввода), чтение бросается: Read дождется данных в фоне, а источник завершится сразу
+func readLines(r io.Reader, out chan interface{}) error {
+	lines := make(chan string)
+	done := make(chan error, 1)
+	quit := make(chan struct{})
+	defer close(quit)
+	go func() {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			if line := scanner.Text(); line != "" {
+				select {
+				case lines <- line:
+				case <-quit:
+					return
+				}
+			}
+		}
+		done <- scanner.Err()
+	}()
+
+	for {
+		select {
+		case line := <-lines:
+			if !send(out, line) {
+				return nil
+			}
+		case err := <-done:
+			return err
+		case <-Stopping(out):
+			return nil
+		}
+	}
+}
+
+// SliceSource отдает элементы items по порядку
+func SliceSource(items ...interface{}) job {
+	return func(in, out chan interface{}) {
+		for _, item := range items {
+			if !send(out, item) {
+				return
+			}
+		}
+	}
+}
+
+// ChanSource отдает все, что приходит в ch, пока его не закроют
+func ChanSource(ch <-chan interface{}) job {
+	return func(in, out chan interface{}) {
+		for {
+			select {
+			case item, ok := <-ch:
+				if !ok || !send(out, item) {
+					return
+				}
+			case <-Stopping(out):
+				return
+			}
+		}
+	}
+}
+
+// TickerSource отдает время каждые interval, всего n раз (n <= 0 - пока конвейер не остановят)
+func TickerSource(interval time.Duration, n int) job {
+	return func(in, out chan interface{}) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for i := 0; n <= 0 || i < n; i++ {
+			select {
+			case t := <-ticker.C:
+				if !send(out, t) {
+					return
+				}
+			case <-Stopping(out):
+				return
+			}
+		}
+	}
+}
+
+// LinesSource отдает непустые строки файлов по порядку
+type LinesSource struct {
+	adapterErr
+	paths []string
+}
+
+func NewLinesSource(paths ...string) *LinesSource {
+	return &LinesSource{paths: paths}
+}
+
+func (s *LinesSource) Run(in, out chan interface{}) {
+	for _, path := range s.paths {
+		file, err := os.Open(path)
+		if err != nil {
+			s.setErr(err)
+			return
+		}
+		err = readLines(file, out)
+		file.Close()
+		if err != nil {
+			s.setErr(err)
+			return
+		}
+	}
+}
+
+// JSONLinesSource декодирует по значению JSON на строку.
+// New создает значение для очередной строки; nil - декодировать в interface{}
+type JSONLinesSource struct {
+	adapterErr
+	r   io.Reader
+	New func() interface{}
+}
+
+func NewJSONLinesSource(r io.Reader) *JSONLinesSource {
+	return &JSONLinesSource{r: r}
+}
+
+func (s *JSONLinesSource) Run(in, out chan interface{}) {
+	dec := json.NewDecoder(s.r)
+	for {
+		var (
+			item interface{}
+			err  error
+		)
+		if s.New != nil {
+			item = s.New()
+			err = dec.Decode(item)
+		} else {
+			err = dec.Decode(&item)
+		}
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			s.setErr(err)
+			return
+		}
+		if !send(out, item) {
+			return
+		}
+	}
+}
+
+// TCPSource принимает соединения на l и отдает строки из каждого.
+// Закрывает l и все соединения, когда конвейер начинает останавливаться
+type TCPSource struct {
+	adapterErr
+	l net.Listener
+}
+
+func NewTCPSource(l net.Listener) *TCPSource {
+	return &TCPSource{l: l}
+}
+
+func (s *TCPSource) Run(in, out chan interface{}) {
+	var (
+		mu     sync.Mutex
+		conns  = map[net.Conn]struct{}{}
+		closed bool
+	)
+	// сначала закрываем соединения, потом ждем их читателей
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go func() {
+		select {
+		case <-Stopping(out):
+		case <-stopped:
+		}
+		mu.Lock()
+		closed = true
+		s.l.Close()
+		for conn := range conns {
+			conn.Close()
+		}
+		mu.Unlock()
+	}()
+
+	for {
+		conn, err := s.l.Accept()
+		if err != nil {
+			mu.Lock()
+			if !closed {
+				s.setErr(err)
+			}
+			mu.Unlock()
+			return
+		}
+		mu.Lock()
+		if closed {
+			mu.Unlock()
+			conn.Close()
+			return
+		}
+		conns[conn] = struct{}{}
+		mu.Unlock()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			readLines(conn, out)
+			mu.Lock()
+			delete(conns, conn)
+			mu.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+// Приемники - последние стадии конвейера. Все они дописывают и закрывают свой выход,
+// когда вход закрыт, поэтому после ExecutePipeline результат уже полный
+
+// WriterSink пишет каждый элемент отдельной строкой через fmt.Sprint
+type WriterSink struct {
+	adapterErr
+	w io.Writer
+	// closer закрывается после записи, если приемник сам открыл файл
+	closer io.Closer
+}
+
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+// NewFileSink создает (или перезаписывает) файл path; ошибка открытия вернется из Err
+func NewFileSink(path string) *WriterSink {
+	file, err := os.Create(path)
+	if err != nil {
+		s := &WriterSink{w: ioutil.Discard}
+		s.setErr(err)
+		return s
+	}
+	return &WriterSink{w: file, closer: file}
+}
+
+func (s *WriterSink) Run(in, out chan interface{}) {
+	w := bufio.NewWriter(s.w)
+	for item := range in {
+		if s.Err() != nil {
+			continue
+		}
+		if _, err := fmt.Fprintln(w, item); err != nil {
+			s.setErr(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		s.setErr(err)
+	}
+	if s.closer != nil {
+		if err := s.closer.Close(); err != nil {
+			s.setErr(err)
+		}
+	}
+}
+
+// JSONLinesSink пишет каждый элемент строкой JSON
+type JSONLinesSink struct {
+	adapterErr
+	w io.Writer
+}
+
+func NewJSONLinesSink(w io.Writer) *JSONLinesSink {
+	return &JSONLinesSink{w: w}
+}
+
+func (s *JSONLinesSink) Run(in, out chan interface{}) {
+	w := bufio.NewWriter(s.w)
+	enc := json.NewEncoder(w)
+	for item := range in {
+		if s.Err() != nil {
+			continue
+		}
+		if err := enc.Encode(item); err != nil {
+			s.setErr(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		s.setErr(err)
+	}
+}
+
+// CallbackSink вызывает f для каждого элемента
+func CallbackSink(f func(item interface{})) job {
+	return func(in, out chan interface{}) {
+		for item := range in {
+			f(item)
+		}
+	}
+}
+
+// Collector собирает элементы в слайс
+type Collector struct {
+	mu    sync.Mutex
+	items []interface{}
+}
+
+func (c *Collector) Run(in, out chan interface{}) {
+	for item := range in {
+		c.mu.Lock()
+		c.items = append(c.items, item)
+		c.mu.Unlock()
+	}
+}
+
+func (c *Collector) Items() []interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	items := make([]interface{}, len(c.items))
+	copy(items, c.items)
+	return items
+}
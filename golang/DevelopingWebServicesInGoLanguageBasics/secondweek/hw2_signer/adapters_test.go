@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSourcesAndSinks(t *testing.T) {
+	dir := filepath.Dir(checkpointPath(t))
+	input := filepath.Join(dir, "input.txt")
+	output := filepath.Join(dir, "output.txt")
+	if err := ioutil.WriteFile(input, []byte("a\nb\n\nc\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	src := NewLinesSource(input)
+	sink := NewFileSink(output)
+	ExecutePipeline(src.Run, mapStrings(strings.ToUpper), sink.Run)
+	if src.Err() != nil || sink.Err() != nil {
+		t.Fatal(src.Err(), sink.Err())
+	}
+
+	data, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "A\nB\nC\n" {
+		t.Errorf("results not match\nGot: %q\nExpected: %q", data, "A\nB\nC\n")
+	}
+
+	missing := NewLinesSource(filepath.Join(dir, "missing.txt"))
+	ExecutePipeline(missing.Run, (&Collector{}).Run)
+	if missing.Err() == nil {
+		t.Errorf("expected error for missing file")
+	}
+}
+
+func mapStrings(f func(string) string) job {
+	return func(in, out chan interface{}) {
+		for v := range in {
+			out <- f(v.(string))
+		}
+	}
+}
+
+type jsonUser struct {
+	Name string `json:"name"`
+	Age  int    `json:"age"`
+}
+
+func TestJSONLines(t *testing.T) {
+	src := NewJSONLinesSource(strings.NewReader(`{"name":"alice","age":30}` + "\n" + `{"name":"bob","age":25}` + "\n"))
+	src.New = func() interface{} { return &jsonUser{} }
+	out := new(bytes.Buffer)
+	sink := NewJSONLinesSink(out)
+	ExecutePipeline(src.Run, sink.Run)
+
+	expected := `{"name":"alice","age":30}` + "\n" + `{"name":"bob","age":25}` + "\n"
+	if src.Err() != nil || sink.Err() != nil || out.String() != expected {
+		t.Errorf("results not match\nGot: %q\nExpected: %q\nErrors: %v %v", out, expected, src.Err(), sink.Err())
+	}
+
+	broken := NewJSONLinesSource(strings.NewReader(`{"name":`))
+	ExecutePipeline(broken.Run, (&Collector{}).Run)
+	if broken.Err() == nil {
+		t.Errorf("expected decode error")
+	}
+}
+
+func TestSliceChanCallback(t *testing.T) {
+	ch := make(chan interface{}, 2)
+	ch <- 3
+	ch <- 4
+	close(ch)
+
+	var got []interface{}
+	ExecutePipeline(SliceSource(1, 2), CallbackSink(func(item interface{}) { got = append(got, item) }))
+	collector := &Collector{}
+	ExecutePipeline(ChanSource(ch), collector.Run)
+	got = append(got, collector.Items()...)
+
+	if expected := []interface{}{1, 2, 3, 4}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", got, expected)
+	}
+}
+
+func TestTickerSourceStops(t *testing.T) {
+	drain := make(chan struct{})
+	collector := &Collector{}
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		close(drain)
+	}()
+	err := (&Pipeline{Jobs: []job{TickerSource(5*time.Millisecond, 0), collector.Run}, Drain: drain}).Run()
+	if err != nil || len(collector.Items()) == 0 {
+		t.Errorf("ticker source did not produce or stop: %v, %d items", err, len(collector.Items()))
+	}
+
+	collector = &Collector{}
+	ExecutePipeline(TickerSource(time.Millisecond, 3), collector.Run)
+	if len(collector.Items()) != 3 {
+		t.Errorf("expected 3 ticks, got %d", len(collector.Items()))
+	}
+}
+
+func TestTCPSource(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := NewTCPSource(l)
+	drain := make(chan struct{})
+	collector := &Collector{}
+
+	go func() {
+		for i := 0; i < 2; i++ {
+			conn, err := net.Dial("tcp", l.Addr().String())
+			if err != nil {
+				t.Error(err)
+				break
+			}
+			fmt.Fprintf(conn, "conn%d-a\nconn%d-b\n", i, i)
+			conn.Close()
+		}
+		for len(collector.Items()) < 4 {
+			time.Sleep(time.Millisecond)
+		}
+		close(drain)
+	}()
+
+	err = (&Pipeline{Jobs: []job{src.Run, collector.Run}, Drain: drain, DrainTimeout: time.Second}).Run()
+	if err != nil || src.Err() != nil {
+		t.Fatal(err, src.Err())
+	}
+
+	var got []string
+	for _, item := range collector.Items() {
+		got = append(got, item.(string))
+	}
+	sort.Strings(got)
+	if expected := []string{"conn0-a", "conn0-b", "conn1-a", "conn1-b"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", got, expected)
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Adaptive подбирает число воркеров одной стадии на ходу, как AIMD: пока во входной очереди
+// есть элементы и пропускная способность не падает, добавляет Step воркеров, а если она
+// упала больше чем на Tolerance - уменьшает число воркеров в Backoff раз.
+// Один Adaptive управляет одной стадией
+type Adaptive struct {
+	Min, Max int
+	// Interval - как часто пересматривать число воркеров
+	Interval time.Duration
+	Step     int
+	Backoff  float64
+	// Tolerance - какое падение пропускной способности (доля) еще считается шумом
+	Tolerance float64
+	// Trace получает каждое решение контроллера; nil - не трассировать
+	Trace func(AdaptiveDecision)
+
+	workers        int32
+	lastThroughput float64
+}
+
+// AdaptiveDecision - одно решение контроллера
+type AdaptiveDecision struct {
+	At   time.Time
+	From int
+	To   int
+	// Throughput - элементов в секунду за прошедший интервал
+	Throughput float64
+	// Queue - сколько элементов ждали воркера
+	Queue int
+	// Latency - среднее время обработки элемента за интервал
+	Latency time.Duration
+	Reason  string
+}
+
+func (d AdaptiveDecision) String() string {
+	return fmt.Sprintf("%d -> %d workers: %s (%.1f items/s, queue %d, latency %s)",
+		d.From, d.To, d.Reason, d.Throughput, d.Queue, d.Latency)
+}
+
+func NewAdaptive(min, max int) *Adaptive {
+	return &Adaptive{
+		Min:       min,
+		Max:       max,
+		Interval:  100 * time.Millisecond,
+		Step:      1,
+		Backoff:   0.5,
+		Tolerance: 0.1,
+	}
+}
+
+// Workers - сколько воркеров контроллер сейчас держит. Сокращенный воркер
+// перестает считаться, только когда доделал свой элемент и ушел
+func (a *Adaptive) Workers() int {
+	return int(atomic.LoadInt32(&a.workers))
+}
+
+func (a *Adaptive) bounds() (int, int) {
+	min, max := a.Min, a.Max
+	if min < 1 {
+		min = 1
+	}
+	if max < min {
+		max = min
+	}
+	return min, max
+}
+
+// next выбирает новое число воркеров по итогам интервала
+func (a *Adaptive) next(workers int, throughput float64, queue int) (int, string) {
+	min, max := a.bounds()
+	last := a.lastThroughput
+	a.lastThroughput = throughput
+
+	switch {
+	case last > 0 && throughput < last*(1-a.Tolerance):
+		to := int(float64(workers) * a.Backoff)
+		if to < min {
+			to = min
+		}
+		// с меньшим числом воркеров сравниваем уже со следующим интервалом,
+		// иначе каждое сокращение само вызывало бы следующее
+		a.lastThroughput = 0
+		return to, "throughput dropped"
+	case queue == 0:
+		return workers, "no backlog"
+	case workers >= max:
+		return workers, "at max"
+	}
+	to := workers + a.Step
+	if a.Step < 1 {
+		to = workers + 1
+	}
+	if to > max {
+		to = max
+	}
+	return to, "backlog, throughput holding"
+}
+
+// Map - стадия, применяющая f к элементам in в меняющемся числе воркеров.
+// Порядок элементов не сохраняется
+func (a *Adaptive) Map(f func(interface{}) interface{}) job {
+	return func(in, out chan interface{}) {
+		min, max := a.bounds()
+		// очередь перед воркерами: по ее длине видно, успевают ли они
+		tasks := make(chan interface{}, max)
+		// quit забирает лишних воркеров, когда контроллер их сокращает.
+		// Воркер, взявший жетон, сам вычитает себя из a.workers
+		quit := make(chan struct{}, max)
+		var (
+			done    int64
+			busyFor int64
+		)
+
+		wg := &sync.WaitGroup{}
+		spawn := func() {
+			wg.Add(1)
+			atomic.AddInt32(&a.workers, 1)
+			go func() {
+				defer wg.Done()
+				for {
+					select {
+					case item, ok := <-tasks:
+						if !ok {
+							return
+						}
+						start := time.Now()
+						adaptiveApply(f, item, out)
+						atomic.AddInt64(&busyFor, int64(time.Since(start)))
+						atomic.AddInt64(&done, 1)
+					case <-quit:
+						atomic.AddInt32(&a.workers, -1)
+						return
+					}
+				}
+			}()
+		}
+		atomic.StoreInt32(&a.workers, 0)
+		for i := 0; i < min; i++ {
+			spawn()
+		}
+
+		stop := make(chan struct{})
+		controlled := make(chan struct{})
+		go func() {
+			defer close(controlled)
+			interval := a.Interval
+			if interval <= 0 {
+				interval = 100 * time.Millisecond
+			}
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			last := time.Now()
+			for {
+				select {
+				case <-stop:
+					return
+				case now := <-ticker.C:
+					// жетоны, которые занятые воркеры не успели взять, отзываются:
+					// иначе они остановили бы воркеров, добавленных позже
+					for revoked := true; revoked; {
+						select {
+						case <-quit:
+						default:
+							revoked = false
+						}
+					}
+					workers := int(atomic.LoadInt32(&a.workers))
+					n := atomic.SwapInt64(&done, 0)
+					busy := atomic.SwapInt64(&busyFor, 0)
+					d := AdaptiveDecision{
+						At:         now,
+						From:       workers,
+						Throughput: float64(n) / now.Sub(last).Seconds(),
+						Queue:      len(tasks),
+					}
+					if n > 0 {
+						d.Latency = time.Duration(busy / n)
+					}
+					last = now
+					d.To, d.Reason = a.next(workers, d.Throughput, d.Queue)
+					for i := workers; i < d.To; i++ {
+						spawn()
+					}
+					// очередь quit пуста, а воркеров не больше max - отправка не блокируется
+					for i := d.To; i < workers; i++ {
+						quit <- struct{}{}
+					}
+					if a.Trace != nil {
+						a.Trace(d)
+					}
+				}
+			}
+		}()
+
+		for item := range in {
+			tasks <- item
+		}
+		close(tasks)
+		close(stop)
+		// пока жив контроллер, он может добавить воркеров - ждем их только после него
+		<-controlled
+		wg.Wait()
+	}
+}
+
+func adaptiveApply(f func(interface{}) interface{}, item interface{}, out chan interface{}) {
+	defer RecoverItem(out, item)
+	out <- f(item)
+}
+
+// AdaptiveSingleHash - SingleHash с числом воркеров, которое подбирает a
+func (s *Signer) AdaptiveSingleHash(a *Adaptive) job {
+	return a.Map(func(rawData interface{}) interface{} {
+		return s.SingleHashOf(fmt.Sprint(rawData))
+	})
+}
+
+// AdaptiveMultiHash - MultiHash с числом воркеров, которое подбирает a
+func (s *Signer) AdaptiveMultiHash(a *Adaptive) job {
+	return a.Map(func(rawData interface{}) interface{} {
+		return s.MultiHashOf(rawData.(string))
+	})
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveDecisions(t *testing.T) {
+	a := NewAdaptive(1, 4)
+	steps := []struct {
+		workers    int
+		throughput float64
+		queue      int
+		expected   int
+	}{
+		{1, 10, 5, 2},
+		{2, 20, 5, 3},
+		// пропускная способность упала - сокращаем вдвое
+		{3, 10, 5, 1},
+		// после сокращения сравнивать не с чем - снова растем
+		{1, 5, 5, 2},
+		{2, 8, 0, 2},
+		{4, 9, 5, 4},
+	}
+	for i, s := range steps {
+		got, reason := a.next(s.workers, s.throughput, s.queue)
+		if got != s.expected {
+			t.Errorf("step %d: expected %d workers, got %d (%s)", i, s.expected, got, reason)
+		}
+	}
+}
+
+func TestAdaptiveMap(t *testing.T) {
+	checkGoroutineLeaks(t)
+	var (
+		mu        sync.Mutex
+		decisions []AdaptiveDecision
+	)
+	a := NewAdaptive(1, 8)
+	a.Interval = 10 * time.Millisecond
+	a.Trace = func(d AdaptiveDecision) {
+		mu.Lock()
+		decisions = append(decisions, d)
+		mu.Unlock()
+	}
+
+	input := make([]int, 100)
+	for i := range input {
+		input[i] = i
+	}
+	var got []int
+	ExecutePipeline(
+		sourceOf(input...),
+		a.Map(func(v interface{}) interface{} {
+			time.Sleep(5 * time.Millisecond)
+			return v.(int) * 2
+		}),
+		collectInts(&got),
+	)
+
+	sort.Ints(got)
+	for i, v := range got {
+		if v != i*2 {
+			t.Fatalf("results not match at %d: %v", i, got)
+		}
+	}
+	if len(got) != len(input) {
+		t.Fatalf("expected %d items, got %d", len(input), len(got))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	peak := 0
+	for _, d := range decisions {
+		if d.To > peak {
+			peak = d.To
+		}
+		if d.To < 1 || d.To > 8 {
+			t.Errorf("decision out of bounds: %v", d)
+		}
+	}
+	// с очередью медленных элементов контроллер должен был добавить воркеров
+	if peak < 2 {
+		t.Errorf("controller never grew, decisions: %v", decisions)
+	}
+}
+
+func TestAdaptiveScaleDownBusyWorkers(t *testing.T) {
+	var (
+		inFlight, maxSeen int32
+		decisions         int
+		dropped           bool
+		afterDrop         []AdaptiveDecision
+	)
+	release := make(chan struct{})
+	a := NewAdaptive(1, 4)
+	a.Interval = 5 * time.Millisecond
+	a.Trace = func(d AdaptiveDecision) {
+		// дойдя до максимума, контроллер видит падение пропускной способности,
+		// когда все воркеры заняты и жетоны сокращения взять некому
+		if dropped && len(afterDrop) < 2 {
+			afterDrop = append(afterDrop, d)
+		}
+		if d.To == 4 && !dropped {
+			dropped = true
+			a.lastThroughput = 1e9
+		}
+		if decisions++; decisions == 10 {
+			close(release)
+		}
+	}
+
+	input := make([]int, 20)
+	var got []int
+	ExecutePipeline(
+		sourceOf(input...),
+		a.Map(func(v interface{}) interface{} {
+			n := atomic.AddInt32(&inFlight, 1)
+			for {
+				m := atomic.LoadInt32(&maxSeen)
+				if n <= m || atomic.CompareAndSwapInt32(&maxSeen, m, n) {
+					break
+				}
+			}
+			<-release
+			atomic.AddInt32(&inFlight, -1)
+			return v
+		}),
+		collectInts(&got),
+	)
+
+	if len(got) != len(input) {
+		t.Fatalf("expected %d items, got %d", len(input), len(got))
+	}
+	// сокращение 4 -> 2 не состоялось: воркеры так и не взяли жетоны, пока были заняты
+	if len(afterDrop) != 2 || afterDrop[0].To != 2 || afterDrop[1].From != 4 {
+		t.Errorf("workers counted before they quit: %v", afterDrop)
+	}
+	if maxSeen > 4 {
+		t.Errorf("workers exceeded Max\nGot: %d\nExpected: <=4", maxSeen)
+	}
+}
+
+func TestAdaptiveSigner(t *testing.T) {
+	withFastSigners(t)
+	s := NewSigner()
+	expected := runSigner(s, 0, 1, 1, 2, 3, 5, 8)
+
+	var res string
+	ExecutePipeline(
+		sourceOf(0, 1, 1, 2, 3, 5, 8),
+		s.AdaptiveSingleHash(NewAdaptive(1, 4)),
+		s.AdaptiveMultiHash(NewAdaptive(1, 4)),
+		CombineResults,
+		job(func(in, out chan interface{}) {
+			res = (<-in).(string)
+		}),
+	)
+	if res != expected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", res, expected)
+	}
+}
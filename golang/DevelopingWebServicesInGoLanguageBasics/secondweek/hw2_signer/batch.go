@@ -0,0 +1,58 @@
+package main
+
+import (
+	"time"
+)
+
+// Batch собирает элементы из in в пачки []interface{}: пачка уходит в out, когда в ней
+// набралось size элементов или с прихода ее первого элемента прошло latency.
+// size <= 0 - без ограничения по размеру, latency <= 0 - без ограничения по времени
+func Batch(size int, latency time.Duration) job {
+	return func(in, out chan interface{}) {
+		var (
+			batch []interface{}
+			timer *time.Timer
+			flush <-chan time.Time
+		)
+		emit := func() {
+			if timer != nil {
+				timer.Stop()
+				timer, flush = nil, nil
+			}
+			if len(batch) > 0 {
+				out <- batch
+				batch = nil
+			}
+		}
+
+		for {
+			select {
+			case item, ok := <-in:
+				if !ok {
+					emit()
+					return
+				}
+				batch = append(batch, item)
+				if len(batch) == 1 && latency > 0 {
+					timer = time.NewTimer(latency)
+					flush = timer.C
+				}
+				if size > 0 && len(batch) >= size {
+					emit()
+				}
+			case <-flush:
+				timer, flush = nil, nil
+				emit()
+			}
+		}
+	}
+}
+
+// Unbatch раскладывает пачки, собранные Batch, обратно на отдельные элементы
+func Unbatch(in, out chan interface{}) {
+	for rawBatch := range in {
+		for _, item := range rawBatch.([]interface{}) {
+			out <- item
+		}
+	}
+}
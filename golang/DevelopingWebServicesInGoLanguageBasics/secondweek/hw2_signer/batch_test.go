@@ -0,0 +1,62 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBatchBySize(t *testing.T) {
+	var got []interface{}
+	ExecutePipeline(
+		sourceOf(1, 2, 3, 4, 5),
+		Batch(2, 0),
+		job(func(in, out chan interface{}) {
+			for v := range in {
+				got = append(got, v)
+			}
+		}),
+	)
+
+	expected := []interface{}{[]interface{}{1, 2}, []interface{}{3, 4}, []interface{}{5}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", got, expected)
+	}
+}
+
+func TestBatchByLatency(t *testing.T) {
+	var got []interface{}
+	ExecutePipeline(
+		job(func(in, out chan interface{}) {
+			out <- 1
+			out <- 2
+			time.Sleep(50 * time.Millisecond)
+			out <- 3
+		}),
+		Batch(10, 10*time.Millisecond),
+		job(func(in, out chan interface{}) {
+			for v := range in {
+				got = append(got, v)
+			}
+		}),
+	)
+
+	expected := []interface{}{[]interface{}{1, 2}, []interface{}{3}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", got, expected)
+	}
+}
+
+func TestUnbatch(t *testing.T) {
+	var got []int
+	ExecutePipeline(
+		sourceOf(1, 2, 3, 4, 5),
+		Batch(2, time.Second),
+		Unbatch,
+		collectInts(&got),
+	)
+
+	if expected := []int{1, 2, 3, 4, 5}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", got, expected)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type BreakerState int
+
+const (
+	// BreakerClosed - ресурс доступен, вызовы проходят, пока их не больше MaxConcurrent
+	BreakerClosed BreakerState = iota
+	// BreakerOpen - ресурс перегрелся, все ждут Cooldown
+	BreakerOpen
+	// BreakerHalfOpen - Cooldown прошел, первый вызов проверяет, остыл ли ресурс
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// OverheatGuard - предохранитель ресурса, который перегревается от одновременных вызовов.
+// Попытка занять занятый ресурс - перегрев; Threshold перегревов подряд размыкают
+// предохранитель на Cooldown, после чего один вызов проверяет, остыл ли ресурс
+type OverheatGuard struct {
+	MaxConcurrent int
+	Threshold     int
+	Cooldown      time.Duration
+	// Clock - источник времени, nil - SignerClock
+	Clock Clock
+
+	// OnOverheat вызывается при каждой попытке занять перегретый ресурс
+	OnOverheat func()
+	// OnStateChange вызывается при каждой смене состояния
+	OnStateChange func(from, to BreakerState)
+
+	mu       sync.Mutex
+	state    BreakerState
+	active   int
+	failures int
+	openedAt time.Time
+	released chan struct{}
+	// cooled закрывается, когда истекает Cooldown; его ждут все, кто пришел к разомкнутому
+	cooled   chan struct{}
+	cooldown Timer
+}
+
+// NewOverheatGuard - предохранитель с поведением исходного OverheatLock:
+// ресурс выдерживает один вызов, а перегретый остывает секунду
+func NewOverheatGuard() *OverheatGuard {
+	return &OverheatGuard{
+		MaxConcurrent: 1,
+		Threshold:     1,
+		Cooldown:      time.Second,
+	}
+}
+
+func (g *OverheatGuard) clock() Clock {
+	if g.Clock != nil {
+		return g.Clock
+	}
+	return SignerClock
+}
+
+func (g *OverheatGuard) State() BreakerState {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.state
+}
+
+// Acquire занимает ресурс, дожидаясь, пока он освободится и остынет, или пока не отменят ctx
+func (g *OverheatGuard) Acquire(ctx context.Context) error {
+	for {
+		acquired, wait := g.tryAcquire()
+		if acquired {
+			return nil
+		}
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// tryAcquire занимает ресурс или возвращает канал, которого надо дождаться перед новой попыткой
+func (g *OverheatGuard) tryAcquire() (bool, <-chan struct{}) {
+	var events []func()
+	defer func() {
+		for _, e := range events {
+			e()
+		}
+	}()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.released == nil {
+		g.released = make(chan struct{})
+	}
+
+	now := g.clock().Now()
+	if g.state == BreakerOpen {
+		if left := g.Cooldown - now.Sub(g.openedAt); left > 0 {
+			return false, g.cooled
+		}
+		events = append(events, g.setState(BreakerHalfOpen))
+	}
+
+	if g.active < g.maxConcurrent() {
+		g.active++
+		g.failures = 0
+		if g.state == BreakerHalfOpen {
+			events = append(events, g.setState(BreakerClosed))
+		}
+		return true, nil
+	}
+
+	g.failures++
+	if g.OnOverheat != nil {
+		events = append(events, g.OnOverheat)
+	}
+	if g.state == BreakerHalfOpen || g.failures >= g.Threshold {
+		g.openedAt = now
+		events = append(events, g.setState(BreakerOpen))
+		return false, g.cooled
+	}
+	return false, g.released
+}
+
+func (g *OverheatGuard) maxConcurrent() int {
+	if g.MaxConcurrent < 1 {
+		return 1
+	}
+	return g.MaxConcurrent
+}
+
+// startCooldown заводит таймер, который закроет g.cooled через Cooldown
+func (g *OverheatGuard) startCooldown() {
+	g.stopCooldown()
+	cooled := make(chan struct{})
+	g.cooled = cooled
+	g.cooldown = g.clock().AfterFunc(g.Cooldown, func() {
+		close(cooled)
+	})
+}
+
+// stopCooldown останавливает таймер и сам будит тех, кто его ждал
+func (g *OverheatGuard) stopCooldown() {
+	if g.cooldown != nil && g.cooldown.Stop() {
+		close(g.cooled)
+	}
+	g.cooldown, g.cooled = nil, nil
+}
+
+// setState меняет состояние под g.mu и возвращает событие, которое надо вызвать уже без блокировки
+func (g *OverheatGuard) setState(to BreakerState) func() {
+	from := g.state
+	g.state = to
+	if to == BreakerOpen {
+		g.startCooldown()
+	} else {
+		g.stopCooldown()
+	}
+	return func() {
+		if g.OnStateChange != nil && from != to {
+			g.OnStateChange(from, to)
+		}
+	}
+}
+
+// Release освобождает ресурс и будит тех, кто ждал его в замкнутом состоянии
+func (g *OverheatGuard) Release() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.active > 0 {
+		g.active--
+	}
+	if g.released != nil {
+		close(g.released)
+	}
+	g.released = make(chan struct{})
+}
+
+// Reset замыкает предохранитель: останавливает остывание и будит всех, кто его ждал
+func (g *OverheatGuard) Reset() {
+	g.mu.Lock()
+	g.failures = 0
+	event := g.setState(BreakerClosed)
+	g.mu.Unlock()
+	event()
+}
+
+// DataSignerGuard охраняет DataSignerMd5 через OverheatLock и OverheatUnlock.
+// Вызывающие, которым нужно уметь сдаться, могут занимать его сами через Acquire(ctx)
+var DataSignerGuard = NewOverheatGuard()
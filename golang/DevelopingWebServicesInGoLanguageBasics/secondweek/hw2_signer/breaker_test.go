@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOverheatGuardStates(t *testing.T) {
+	clock := NewFakeClock()
+	var (
+		mu          sync.Mutex
+		transitions []string
+		overheats   int
+	)
+	g := &OverheatGuard{
+		MaxConcurrent: 1,
+		Threshold:     2,
+		Cooldown:      time.Second,
+		Clock:         clock,
+		OnOverheat: func() {
+			mu.Lock()
+			overheats++
+			mu.Unlock()
+		},
+		OnStateChange: func(from, to BreakerState) {
+			mu.Lock()
+			transitions = append(transitions, from.String()+"->"+to.String())
+			mu.Unlock()
+		},
+	}
+
+	if err := g.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// две неудачные попытки подряд размыкают предохранитель
+	if ok, _ := g.tryAcquire(); ok {
+		t.Fatal("busy resource acquired")
+	}
+	if g.State() != BreakerClosed {
+		t.Errorf("opened before threshold: %s", g.State())
+	}
+	if ok, _ := g.tryAcquire(); ok {
+		t.Fatal("busy resource acquired")
+	}
+	if g.State() != BreakerOpen {
+		t.Errorf("expected open state, got %s", g.State())
+	}
+
+	// пока не прошел Cooldown, ресурс не выдается даже освобожденным
+	g.Release()
+	if ok, _ := g.tryAcquire(); ok {
+		t.Errorf("acquired while open")
+	}
+	clock.Advance(time.Second)
+	if ok, _ := g.tryAcquire(); !ok {
+		t.Errorf("probe call not allowed after cooldown")
+	}
+	g.Release()
+
+	expected := []string{"closed->open", "open->half-open", "half-open->closed"}
+	if !reflect.DeepEqual(transitions, expected) || overheats != 2 {
+		t.Errorf("unexpected events: %v, %d overheats", transitions, overheats)
+	}
+}
+
+func TestOverheatGuardContext(t *testing.T) {
+	g := NewOverheatGuard()
+	g.Clock = NewFakeClock()
+	g.Acquire(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := g.Acquire(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected caller to give up, got %v", err)
+	}
+}
+
+func TestOverheatGuardWaitsForRelease(t *testing.T) {
+	g := &OverheatGuard{MaxConcurrent: 2, Threshold: 100, Cooldown: time.Hour}
+	g.Acquire(context.Background())
+	g.Acquire(context.Background())
+
+	acquired := make(chan struct{})
+	go func() {
+		g.Acquire(context.Background())
+		close(acquired)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	g.Release()
+
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Errorf("waiter not woken by release")
+	}
+}
+
+func TestOverheatGuardCooldownTimer(t *testing.T) {
+	clock := NewFakeClock()
+	g := &OverheatGuard{MaxConcurrent: 1, Threshold: 1, Cooldown: time.Second, Clock: clock}
+	g.Acquire(context.Background())
+	if ok, _ := g.tryAcquire(); ok || g.State() != BreakerOpen {
+		t.Fatalf("expected open state, got %s", g.State())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	acquired := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			acquired <- g.Acquire(ctx)
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	// все ждут одного таймера остывания
+	if clock.Sleepers() != 1 {
+		t.Errorf("%d timers for one cooldown", clock.Sleepers())
+	}
+
+	// Reset останавливает таймер и будит ждущих
+	g.Release()
+	g.Reset()
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiters not woken by reset")
+	}
+	cancel()
+	for i := 0; i < 2; i++ {
+		<-acquired
+	}
+	g.Reset()
+	if clock.Sleepers() != 0 {
+		t.Errorf("cooldown timer not stopped by reset: %d sleepers", clock.Sleepers())
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Memo запоминает результаты функции подписи (LRU на size записей)
+// и склеивает одновременные вызовы с одинаковым аргументом в один
+type Memo struct {
+	size int
+
+	mu       sync.Mutex
+	items    map[string]*list.Element
+	order    *list.List
+	inflight map[string]*memoCall
+}
+
+type memoEntry struct {
+	key   string
+	value string
+}
+
+type memoCall struct {
+	wg    sync.WaitGroup
+	value string
+	// panicked - f упала, ее паника повторяется у всех, кто ждал этот вызов
+	panicked interface{}
+}
+
+func NewMemo(size int) *Memo {
+	return &Memo{
+		size:     size,
+		items:    make(map[string]*list.Element, size),
+		order:    list.New(),
+		inflight: make(map[string]*memoCall),
+	}
+}
+
+// Do возвращает f(data) из кеша или считает его, если результата еще нет
+func (m *Memo) Do(data string, f func(string) string) string {
+	// соль меняет результат подписи, поэтому входит в ключ
+	key := DataSignerSalt + "\x00" + data
+
+	m.mu.Lock()
+	if el, ok := m.items[key]; ok {
+		m.order.MoveToFront(el)
+		m.mu.Unlock()
+		return el.Value.(*memoEntry).value
+	}
+	if call, ok := m.inflight[key]; ok {
+		m.mu.Unlock()
+		call.wg.Wait()
+		if _, aborted := call.panicked.(recipeAbort); aborted {
+			// ведущий бросил вычисление из-за своего ctx - это не результат, считаем сами
+			return m.Do(data, f)
+		}
+		if call.panicked != nil {
+			panic(call.panicked)
+		}
+		return call.value
+	}
+	call := &memoCall{}
+	call.wg.Add(1)
+	m.inflight[key] = call
+	m.mu.Unlock()
+
+	m.call(key, call, data, f)
+	if call.panicked != nil {
+		panic(call.panicked)
+	}
+	return call.value
+}
+
+// call считает f(data) для ждущих key; если f паникует, запись inflight все равно
+// убирается, чтобы следующие вызовы с тем же аргументом не ждали вечно
+func (m *Memo) call(key string, call *memoCall, data string, f func(string) string) {
+	ok := false
+	defer func() {
+		if !ok {
+			call.panicked = recover()
+		}
+		m.mu.Lock()
+		delete(m.inflight, key)
+		if ok {
+			m.add(key, call.value)
+		}
+		m.mu.Unlock()
+		call.wg.Done()
+	}()
+	call.value = f(data)
+	ok = true
+}
+
+func (m *Memo) add(key, value string) {
+	if m.size <= 0 {
+		return
+	}
+	m.items[key] = m.order.PushFront(&memoEntry{key: key, value: value})
+	for m.order.Len() > m.size {
+		last := m.order.Back()
+		m.order.Remove(last)
+		delete(m.items, last.Value.(*memoEntry).key)
+	}
+}
+
+func (m *Memo) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.order.Len()
+}
+
+// Wrap оборачивает функцию подписи, например
+// DataSignerCrc32 = NewMemo(1000).Wrap(DataSignerCrc32)
+func (m *Memo) Wrap(f func(string) string) func(string) string {
+	return func(data string) string {
+		return m.Do(data, f)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMemoRepeatedInputs(t *testing.T) {
+	var calls uint32
+	f := NewMemo(10).Wrap(func(data string) string {
+		atomic.AddUint32(&calls, 1)
+		return data + "!"
+	})
+
+	for i := 0; i < 3; i++ {
+		if res := f("a"); res != "a!" {
+			t.Errorf("bad result\nGot: %s\nExpected: a!", res)
+		}
+	}
+	f("b")
+
+	if calls != 2 {
+		t.Errorf("signer called again for cached input\nGot: %d calls\nExpected: 2", calls)
+	}
+}
+
+func TestMemoSingleFlight(t *testing.T) {
+	var calls uint32
+	f := NewMemo(10).Wrap(func(data string) string {
+		atomic.AddUint32(&calls, 1)
+		time.Sleep(20 * time.Millisecond)
+		return data
+	})
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			f("a")
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("concurrent calls not deduplicated\nGot: %d calls\nExpected: 1", calls)
+	}
+}
+
+func TestMemoPanic(t *testing.T) {
+	m := NewMemo(10)
+	release := make(chan struct{})
+	boom := func(data string) string {
+		<-release
+		panic("boom " + data)
+	}
+	do := func(f func(string) string) (res string, panicked interface{}) {
+		defer func() { panicked = recover() }()
+		return m.Do("a", f), nil
+	}
+
+	leader, waiter := make(chan interface{}), make(chan interface{})
+	go func() {
+		_, p := do(boom)
+		leader <- p
+	}()
+	time.Sleep(10 * time.Millisecond)
+	go func() {
+		_, p := do(func(string) string { return "waiter" })
+		waiter <- p
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+
+	if p := <-leader; p != "boom a" {
+		t.Errorf("leader panic\nGot: %v\nExpected: boom a", p)
+	}
+	if p := <-waiter; p != "boom a" {
+		t.Errorf("waiter panic\nGot: %v\nExpected: boom a", p)
+	}
+
+	done := make(chan string)
+	go func() {
+		res, _ := do(func(data string) string { return data + "!" })
+		done <- res
+	}()
+	select {
+	case res := <-done:
+		if res != "a!" {
+			t.Errorf("bad result after panic\nGot: %s\nExpected: a!", res)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Do after a panicking call blocked")
+	}
+}
+
+func TestMemoAbort(t *testing.T) {
+	m := NewMemo(10)
+	release := make(chan struct{})
+	leader := make(chan interface{})
+	go func() {
+		defer func() { leader <- recover() }()
+		m.Do("a", func(string) string {
+			<-release
+			panic(recipeAbort{context.Canceled})
+		})
+	}()
+	time.Sleep(10 * time.Millisecond)
+	// отмена чужого ctx не должна доставаться ждущему с живым ctx
+	waiter := make(chan string)
+	go func() {
+		waiter <- m.Do("a", func(data string) string { return data + "!" })
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+
+	if p, ok := (<-leader).(recipeAbort); !ok || p.err != context.Canceled {
+		t.Errorf("leader should get its own abort, got %v", p)
+	}
+	select {
+	case res := <-waiter:
+		if res != "a!" {
+			t.Errorf("bad waiter result\nGot: %s\nExpected: a!", res)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiter blocked after leader abort")
+	}
+}
+
+func TestMemoEviction(t *testing.T) {
+	var calls uint32
+	m := NewMemo(2)
+	f := m.Wrap(func(data string) string {
+		atomic.AddUint32(&calls, 1)
+		return data
+	})
+
+	f("a")
+	f("b")
+	f("a")
+	f("c") // вытесняет b
+	f("a")
+	f("b")
+
+	if m.Len() != 2 {
+		t.Errorf("cache size not bounded\nGot: %d\nExpected: 2", m.Len())
+	}
+	if calls != 4 {
+		t.Errorf("unexpected signer calls\nGot: %d\nExpected: 4", calls)
+	}
+}
+
+func TestSignerCache(t *testing.T) {
+	calls := withFastSigners(t)
+
+	expected := runSigner(NewSigner(), 1, 2)
+	calls.md5, calls.crc32 = 0, 0
+
+	s := NewSigner()
+	s.Md5Cache = NewMemo(100)
+	s.Crc32Cache = NewMemo(100)
+	runSigner(s, 1, 2, 1)
+	if res := runSigner(s, 1, 2); res != expected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", res, expected)
+	}
+
+	if calls.md5 != 2 || calls.crc32 != 16 {
+		t.Errorf("cached signers called again\nGot: md5=%d crc32=%d\nExpected: md5=2 crc32=16", calls.md5, calls.crc32)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// Checkpoint - журнал уже обработанных элементов (по строке JSON на элемент, только дописывается).
+// При повторном запуске элементы из журнала не пересчитываются.
+// Первая строка - заголовок с параметрами, от которых зависят результаты (соль, рецепты)
+type Checkpoint struct {
+	mu   sync.Mutex
+	file *os.File
+	done map[string]json.RawMessage
+	err  error
+}
+
+type checkpointHeader struct {
+	Params string `json:"params"`
+}
+
+type checkpointRecord struct {
+	Input  string          `json:"input"`
+	Result json.RawMessage `json:"result"`
+}
+
+// OpenCheckpoint открывает журнал, создавая его при необходимости.
+// Журнал, начатый с другими params, не продолжается: его результаты посчитаны иначе.
+// Недописанная последняя строка (упали посреди записи) отбрасывается
+func OpenCheckpoint(path, params string) (*Checkpoint, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	c := &Checkpoint{
+		file: file,
+		done: make(map[string]json.RawMessage),
+	}
+	if err = c.load(params); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Checkpoint) load(params string) error {
+	reader := bufio.NewReader(c.file)
+	var (
+		offset int64
+		lineNo int
+	)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		lineNo++
+		if lineNo == 1 {
+			var header checkpointHeader
+			if err := json.Unmarshal(line, &header); err != nil {
+				return fmt.Errorf("checkpoint %s: header: %v", c.file.Name(), err)
+			}
+			if header.Params != params {
+				return fmt.Errorf("checkpoint %s was written with %s, now %s: remove it to start over",
+					c.file.Name(), header.Params, params)
+			}
+			offset += int64(len(line))
+			continue
+		}
+		var rec checkpointRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return fmt.Errorf("checkpoint %s: line %d: %v", c.file.Name(), lineNo, err)
+		}
+		c.done[rec.Input] = rec.Result
+		offset += int64(len(line))
+	}
+	if err := c.file.Truncate(offset); err != nil {
+		return err
+	}
+	if _, err := c.file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	if lineNo > 0 {
+		return nil
+	}
+	header, err := json.Marshal(checkpointHeader{Params: params})
+	if err != nil {
+		return err
+	}
+	_, err = c.file.Write(append(header, '\n'))
+	return err
+}
+
+// Lookup достает из журнала результат для input; false - элемент еще не обрабатывался
+func (c *Checkpoint) Lookup(input string, result interface{}) (bool, error) {
+	c.mu.Lock()
+	raw, ok := c.done[input]
+	c.mu.Unlock()
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(raw, result)
+}
+
+// Save дописывает результат элемента в журнал
+func (c *Checkpoint) Save(input string, result interface{}) error {
+	raw, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(checkpointRecord{Input: input, Result: raw})
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.done[input]; ok {
+		// одинаковые входы дают одинаковый результат, второй раз не пишем
+		return nil
+	}
+	// строка пишется одним вызовом, чтобы при падении оборвалась максимум последняя
+	if _, err = c.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	c.done[input] = raw
+	return nil
+}
+
+// Len - сколько элементов в журнале
+func (c *Checkpoint) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.done)
+}
+
+// saveOrRemember - Save для стадий, которым некуда вернуть ошибку: ее можно получить через Err
+func (c *Checkpoint) saveOrRemember(input string, result interface{}) {
+	if err := c.Save(input, result); err != nil {
+		c.mu.Lock()
+		if c.err == nil {
+			c.err = err
+		}
+		c.mu.Unlock()
+	}
+}
+
+// Err - первая ошибка записи в журнал из стадии Map
+func (c *Checkpoint) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *Checkpoint) Close() error {
+	if err := c.file.Sync(); err != nil {
+		c.file.Close()
+		return err
+	}
+	return c.file.Close()
+}
+
+// Map - стадия, которая считает f для элементов, которых еще нет в журнале,
+// и берет готовый результат для остальных
+func (c *Checkpoint) Map(workers int, f func(input string) string) job {
+	if workers < 1 {
+		workers = 1
+	}
+	return func(in, out chan interface{}) {
+		tasks := make(chan interface{})
+		wg := &sync.WaitGroup{}
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for rawData := range tasks {
+					c.mapItem(rawData, f, out)
+				}
+			}()
+		}
+		for rawData := range in {
+			tasks <- rawData
+		}
+		close(tasks)
+		wg.Wait()
+	}
+}
+
+func (c *Checkpoint) mapItem(rawData interface{}, f func(string) string, out chan interface{}) {
+	defer RecoverItem(out, rawData)
+	input := fmt.Sprint(rawData)
+
+	var res string
+	if ok, err := c.Lookup(input, &res); ok && err == nil {
+		out <- res
+		return
+	}
+	res = f(input)
+	c.saveOrRemember(input, res)
+	out <- res
+}
+
+// CheckpointParams - параметры подписи для OpenCheckpoint: соль и рецепты
+func (s *Signer) CheckpointParams() string {
+	params, _ := json.Marshal(map[string]string{
+		"salt":   s.Salt + DataSignerSalt,
+		"single": s.singleRecipe().Canonical(),
+		"multi":  s.multiRecipe().Canonical(),
+	})
+	return string(params)
+}
+
+// CheckpointedHash заменяет пару стадий SingleHash и MultiHash, запоминая результаты в журнале
+func (s *Signer) CheckpointedHash(c *Checkpoint, workers int) job {
+	return c.Map(workers, s.Sign)
+}
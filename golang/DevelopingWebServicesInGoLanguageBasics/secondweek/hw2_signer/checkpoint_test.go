@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func checkpointPath(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "hw2_signer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "checkpoint.log")
+}
+
+func runCheckpointed(t *testing.T, path string, inputData ...interface{}) string {
+	s := NewSigner()
+	cp, err := OpenCheckpoint(path, s.CheckpointParams())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cp.Close()
+
+	var res string
+	ExecutePipeline(
+		job(func(in, out chan interface{}) {
+			for _, data := range inputData {
+				out <- data
+			}
+		}),
+		s.CheckpointedHash(cp, 4),
+		job(CombineResults),
+		job(func(in, out chan interface{}) {
+			res = (<-in).(string)
+		}),
+	)
+	if err := cp.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestCheckpointResume(t *testing.T) {
+	calls := withFastSigners(t)
+	expected := runSigner(NewSigner(), 0, 1, 2, 3, 4)
+	path := checkpointPath(t)
+
+	// первый запуск "упал" после трех элементов, оборвав запись четвертого
+	runCheckpointed(t, path, 0, 1, 2)
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"input":"3","res`)
+	file.Close()
+
+	calls.crc32 = 0
+	if res := runCheckpointed(t, path, 0, 1, 2, 3, 4); res != expected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", res, expected)
+	}
+	if calls.crc32 != 2*8 {
+		t.Errorf("checkpointed items signed again: %d crc32 calls, expected %d", calls.crc32, 2*8)
+	}
+
+	cp, err := OpenCheckpoint(path, NewSigner().CheckpointParams())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cp.Close()
+	if cp.Len() != 5 {
+		t.Errorf("unexpected checkpoint size: %d", cp.Len())
+	}
+}
+
+func TestCheckpointCorrupted(t *testing.T) {
+	path := checkpointPath(t)
+	if err := ioutil.WriteFile(path, []byte("garbage\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenCheckpoint(path, ""); err == nil {
+		t.Errorf("expected error for corrupted checkpoint")
+	}
+}
+
+func TestCheckpointParams(t *testing.T) {
+	withFastSigners(t)
+	path := checkpointPath(t)
+	runCheckpointed(t, path, 0, 1, 2)
+
+	// с другой солью старые подписи неверны
+	s := NewSigner()
+	s.Salt = "pepper"
+	if _, err := OpenCheckpoint(path, s.CheckpointParams()); err == nil {
+		t.Errorf("expected error for checkpoint with other salt")
+	}
+
+	s = NewSigner()
+	s.SingleRecipe = MustParseRecipe(`crc32(data)+"~"+crc32(md5(data))`)
+	if s.CheckpointParams() != NewSigner().CheckpointParams() {
+		t.Errorf("recipes differ only in spaces, got params %s", s.CheckpointParams())
+	}
+	s.SingleRecipe = MustParseRecipe(`crc32(md5(data)) + "~" + crc32(data)`)
+	if _, err := OpenCheckpoint(path, s.CheckpointParams()); err == nil {
+		t.Errorf("expected error for checkpoint with other recipe")
+	}
+}
+
+func TestCLICheckpoint(t *testing.T) {
+	calls := withFastSigners(t)
+	path := checkpointPath(t)
+
+	first := new(bytes.Buffer)
+	if err := run([]string{"-range", "0:3", "-checkpoint", path}, nil, first); err != nil {
+		t.Fatal(err)
+	}
+	calls.crc32 = 0
+	second := new(bytes.Buffer)
+	if err := run([]string{"-range", "0:3", "-checkpoint", path}, nil, second); err != nil {
+		t.Fatal(err)
+	}
+
+	if first.String() != second.String() {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", second, first)
+	}
+	if calls.crc32 != 0 {
+		t.Errorf("checkpointed items signed again: %d crc32 calls", calls.crc32)
+	}
+
+	err := run([]string{"-range", "0:3", "-checkpoint", path, "-salt", "pepper"}, nil, ioutil.Discard)
+	if err == nil || !strings.Contains(err.Error(), "pepper") {
+		t.Errorf("expected error for resume with other salt, got %v", err)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCLIRange(t *testing.T) {
+	withFastSigners(t)
+	s := NewSigner()
+
+	out := new(bytes.Buffer)
+	if err := run([]string{"-range", "0:3", "-parallel", "2"}, nil, out); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("unexpected output:\n%s", out)
+	}
+	for i, input := range []string{"0", "1", "2"} {
+		single := s.SingleHashOf(input)
+		expected := input + "\t" + single + "\t" + s.MultiHashOf(single)
+		if lines[i] != expected {
+			t.Errorf("results not match\nGot: %v\nExpected: %v", lines[i], expected)
+		}
+	}
+	if expected := "combined\t" + runSigner(s, 0, 1, 2); lines[3] != expected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", lines[3], expected)
+	}
+}
+
+func TestCLIStdinJSON(t *testing.T) {
+	withFastSigners(t)
+
+	out := new(bytes.Buffer)
+	err := run([]string{"-format", "json", "-salt", "pepper"}, strings.NewReader("alice\n\nbob\n"), out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dec := json.NewDecoder(out)
+	var items []signed
+	for i := 0; i < 2; i++ {
+		var item signed
+		if err := dec.Decode(&item); err != nil {
+			t.Fatal(err)
+		}
+		items = append(items, item)
+	}
+	if items[0].Input != "alice" || items[1].Input != "bob" {
+		t.Errorf("unexpected items: %+v", items)
+	}
+	s := NewSigner()
+	s.Salt = "pepper"
+	if items[0].Single != s.SingleHashOf("alice") || items[0].Single == NewSigner().SingleHashOf("alice") {
+		t.Errorf("salt not applied: %+v", items[0])
+	}
+	var combined map[string]string
+	if err := dec.Decode(&combined); err != nil || combined["combined"] == "" {
+		t.Errorf("combined result missing: %v %v", combined, err)
+	}
+}
+
+func TestCLIFiles(t *testing.T) {
+	withFastSigners(t)
+
+	dir, err := ioutil.TempDir("", "hw2_signer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "input.txt")
+	if err := ioutil.WriteFile(name, []byte("0\n1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fromFile := new(bytes.Buffer)
+	if err := run([]string{name}, nil, fromFile); err != nil {
+		t.Fatal(err)
+	}
+	fromRange := new(bytes.Buffer)
+	if err := run([]string{"-range", "0:2"}, nil, fromRange); err != nil {
+		t.Fatal(err)
+	}
+	if fromFile.String() != fromRange.String() {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", fromFile, fromRange)
+	}
+
+	if err := run([]string{filepath.Join(dir, "missing.txt")}, nil, ioutil.Discard); err == nil {
+		t.Errorf("expected error for missing file")
+	}
+}
+
+func TestCLIBadArgs(t *testing.T) {
+	for _, args := range [][]string{
+		{"-format", "xml"},
+		{"-range", "1"},
+		{"-range", "a:b"},
+		{"-parallel", "0"},
+		{"-single-recipe", "crc32("},
+		{"-range", "0:1", "file.txt"},
+	} {
+		if err := run(args, strings.NewReader(""), ioutil.Discard); err == nil {
+			t.Errorf("expected error for %v", args)
+		}
+	}
+}
+
+// runWithSignals запускает CLI на stdin из pipe, пишет в него lines и после этого
+// отправляет процессу signals сигналов SIGINT
+func runWithSignals(t *testing.T, lines string, signals int) (string, error) {
+	r, w := io.Pipe()
+	defer w.Close()
+	out := new(bytes.Buffer)
+	done := make(chan error, 1)
+	go func() {
+		done <- run(nil, r, out)
+	}()
+
+	// запись в pipe возвращается, когда строки прочитаны, то есть DrainOnSignal уже следит за сигналами
+	io.WriteString(w, lines)
+	for i := 0; i < signals; i++ {
+		time.Sleep(50 * time.Millisecond)
+		syscall.Kill(syscall.Getpid(), syscall.SIGINT)
+	}
+	select {
+	case err := <-done:
+		return out.String(), err
+	case <-time.After(2 * time.Second):
+		t.Fatal("CLI did not stop after SIGINT")
+	}
+	return "", nil
+}
+
+func TestCLIDrainIdleStdin(t *testing.T) {
+	withFastSigners(t)
+	s := NewSigner()
+
+	out, err := runWithSignals(t, "a\n", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	single := s.SingleHashOf("a")
+	expected := "a\t" + single + "\t" + s.MultiHashOf(single) + "\ncombined\t" + runSigner(s, "a") + "\n"
+	if out != expected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", out, expected)
+	}
+}
+
+func TestCLIAbortFlushesOutput(t *testing.T) {
+	withFastSigners(t)
+	s := NewSigner()
+	single := s.SingleHashOf("a")
+	expected := "a\t" + single + "\t" + s.MultiHashOf(single) + "\n"
+
+	// b не подписывается никогда: дренаж не кончится сам, его прерывает второй сигнал.
+	// Брошенная горутина так и остается ждать, иначе она прочитала бы DataSigner*,
+	// которые восстанавливает Cleanup. Атомарный счетчик упорядочивает уже сделанные
+	// вызовы брошенного конвейера перед восстановлением
+	var finished uint32
+	defer func() { atomic.LoadUint32(&finished) }()
+	md5, crc32 := DataSignerMd5, DataSignerCrc32
+	DataSignerMd5 = func(data string) string {
+		defer atomic.AddUint32(&finished, 1)
+		return md5(data)
+	}
+	DataSignerCrc32 = func(data string) string {
+		res := crc32(data)
+		atomic.AddUint32(&finished, 1)
+		if data == "b" {
+			select {}
+		}
+		return res
+	}
+
+	out, err := runWithSignals(t, "a\nb\n", 2)
+	if _, ok := err.(*DrainError); !ok {
+		t.Fatalf("expected DrainError, got %v", err)
+	}
+	if out != expected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", out, expected)
+	}
+}
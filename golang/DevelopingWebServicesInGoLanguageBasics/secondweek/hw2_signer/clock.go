@@ -0,0 +1,183 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock - источник времени для подписывающих функций и OverheatLock
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+	After(d time.Duration) <-chan time.Time
+	// AfterFunc вызывает f в отдельной горутине через d, как time.AfterFunc
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer - отложенный вызов AfterFunc; Stop возвращает false, если f уже вызвана
+type Timer interface {
+	Stop() bool
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                            { return time.Now() }
+func (realClock) Sleep(d time.Duration)                     { time.Sleep(d) }
+func (realClock) After(d time.Duration) <-chan time.Time    { return time.After(d) }
+func (realClock) AfterFunc(d time.Duration, f func()) Timer { return time.AfterFunc(d, f) }
+
+// SignerClock используется DataSigner* и OverheatLock/OverheatUnlock вместо пакета time
+var SignerClock Clock = realClock{}
+
+// FakeClock - виртуальное время для тестов: Sleep и After ждут, пока время не передвинут Advance
+type FakeClock struct {
+	mu       sync.Mutex
+	now      time.Time
+	sleepers []*fakeSleeper
+	// version растет при каждом новом ожидании, AutoAdvance по нему понимает, что все уснули
+	version int
+}
+
+type fakeSleeper struct {
+	until time.Time
+	ch    chan time.Time
+	// f - вместо отправки в ch, для AfterFunc
+	f func()
+}
+
+func NewFakeClock() *FakeClock {
+	return &FakeClock{now: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.sleepers = append(c.sleepers, &fakeSleeper{until: c.now.Add(d), ch: ch})
+	c.version++
+	return ch
+}
+
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := &fakeSleeper{until: c.now.Add(d), f: f}
+	if d <= 0 {
+		go f()
+		return &fakeTimer{clock: c, sleeper: s}
+	}
+	c.sleepers = append(c.sleepers, s)
+	c.version++
+	return &fakeTimer{clock: c, sleeper: s}
+}
+
+type fakeTimer struct {
+	clock   *FakeClock
+	sleeper *fakeSleeper
+}
+
+func (t *fakeTimer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, s := range c.sleepers {
+		if s == t.sleeper {
+			c.sleepers = append(c.sleepers[:i], c.sleepers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (c *FakeClock) Sleep(d time.Duration) {
+	<-c.After(d)
+}
+
+// Advance передвигает время и будит всех, чье ожидание истекло
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.advanceTo(c.now.Add(d))
+}
+
+func (c *FakeClock) advanceTo(t time.Time) {
+	c.now = t
+	sort.SliceStable(c.sleepers, func(i, j int) bool {
+		return c.sleepers[i].until.Before(c.sleepers[j].until)
+	})
+	n := 0
+	for n < len(c.sleepers) && !c.sleepers[n].until.After(t) {
+		// f берет свои блокировки, а под c.mu их держать нельзя
+		if f := c.sleepers[n].f; f != nil {
+			go f()
+		} else {
+			c.sleepers[n].ch <- t
+		}
+		n++
+	}
+	c.sleepers = c.sleepers[n:]
+}
+
+// Sleepers - сколько горутин сейчас ждут времени
+func (c *FakeClock) Sleepers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.sleepers)
+}
+
+// BlockUntil ждет, пока времени не будут ждать n горутин
+func (c *FakeClock) BlockUntil(n int) {
+	for c.Sleepers() < n {
+		time.Sleep(100 * time.Microsecond)
+	}
+}
+
+// AutoAdvance сам передвигает время к ближайшему пробуждению, как только за quiet реального
+// времени никто не начал новое ожидание, то есть все, кто мог работать, уже уснули.
+// Возвращает функцию остановки
+func (c *FakeClock) AutoAdvance(quiet time.Duration) func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		lastVersion := -1
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(quiet):
+			}
+			c.mu.Lock()
+			if c.version == lastVersion && len(c.sleepers) > 0 {
+				next := c.sleepers[0].until
+				for _, s := range c.sleepers {
+					if s.until.Before(next) {
+						next = s.until
+					}
+				}
+				c.advanceTo(next)
+			}
+			lastVersion = c.version
+			c.mu.Unlock()
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
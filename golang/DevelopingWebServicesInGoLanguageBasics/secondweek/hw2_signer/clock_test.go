@@ -0,0 +1,97 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// исходные функции из common.go: TestSigner подменяет их на версии с настоящим time.Sleep
+var (
+	origOverheatLock   = OverheatLock
+	origOverheatUnlock = OverheatUnlock
+	origDataSignerMd5  = DataSignerMd5
+	origDataSignerCrc  = DataSignerCrc32
+)
+
+func withFakeClock(t *testing.T) *FakeClock {
+	clock := NewFakeClock()
+	saved := []interface{}{SignerClock, OverheatLock, OverheatUnlock, DataSignerMd5, DataSignerCrc32}
+	SignerClock = clock
+	OverheatLock, OverheatUnlock = origOverheatLock, origOverheatUnlock
+	DataSignerMd5, DataSignerCrc32 = origDataSignerMd5, origDataSignerCrc
+	stop := clock.AutoAdvance(time.Millisecond)
+	t.Cleanup(func() {
+		stop()
+		SignerClock = saved[0].(Clock)
+		OverheatLock, OverheatUnlock = saved[1].(func()), saved[2].(func())
+		DataSignerMd5, DataSignerCrc32 = saved[3].(func(string) string), saved[4].(func(string) string)
+	})
+	return clock
+}
+
+func TestFakeClockAdvance(t *testing.T) {
+	clock := NewFakeClock()
+	start := clock.Now()
+	first, second := clock.After(time.Second), clock.After(2*time.Second)
+
+	clock.BlockUntil(2)
+	clock.Advance(time.Second)
+	select {
+	case now := <-first:
+		if now.Sub(start) != time.Second {
+			t.Errorf("woken at wrong time: %s", now.Sub(start))
+		}
+	default:
+		t.Errorf("sleeper not woken")
+	}
+	select {
+	case <-second:
+		t.Errorf("sleeper woken too early")
+	default:
+	}
+	if clock.Sleepers() != 1 {
+		t.Errorf("unexpected sleepers: %d", clock.Sleepers())
+	}
+}
+
+func TestFakeClockPipeline(t *testing.T) {
+	clock := withFakeClock(t)
+
+	start, realStart := clock.Now(), time.Now()
+	res := runSigner(NewSigner(), 0, 1, 1, 2, 3, 5, 8)
+	elapsed, realElapsed := clock.Since(start), time.Since(realStart)
+
+	expected := "1173136728138862632818075107442090076184424490584241521304_1696913515191343735512658979631549563179965036907783101867_27225454331033649287118297354036464389062965355426795162684_29568666068035183841425683795340791879727309630931025356555_3994492081516972096677631278379039212655368881548151736_4958044192186797981418233587017209679042592862002427381542_4958044192186797981418233587017209679042592862002427381542"
+	if res != expected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", res, expected)
+	}
+	// 7 последовательных md5 по 10ms и два слоя параллельных crc32 по секунде: ровно 2.07s
+	if elapsed < 2*time.Second+70*time.Millisecond || elapsed >= 3*time.Second {
+		t.Errorf("unexpected virtual time: %s", elapsed)
+	}
+	if realElapsed > time.Second {
+		t.Errorf("fake clock pipeline took real time: %s", realElapsed)
+	}
+}
+
+func TestFakeClockOverheat(t *testing.T) {
+	clock := withFakeClock(t)
+
+	// без ограничителя два одновременных md5 перегревают подписывающую функцию
+	s := &Signer{}
+	start := clock.Now()
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			s.md5("data")
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+
+	if elapsed := clock.Since(start); elapsed < time.Second {
+		t.Errorf("overheat did not cost a second: %s", elapsed)
+	}
+}
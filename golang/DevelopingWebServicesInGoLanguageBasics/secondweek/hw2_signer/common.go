@@ -1,11 +1,11 @@
 package main
 
 import (
+	"context"
 	"crypto/md5"
 	"fmt"
 	"hash/crc32"
 	"strconv"
-	"sync/atomic"
 	"time"
 )
 
@@ -16,30 +16,17 @@ const (
 )
 
 var (
+	// dataSignerOverheat не используется DataSignerGuard, его берут тесты со своим OverheatLock
 	dataSignerOverheat uint32 = 0
 	DataSignerSalt            = ""
 )
 
 var OverheatLock = func() {
-	for {
-		if swapped := atomic.CompareAndSwapUint32(&dataSignerOverheat, 0, 1); !swapped {
-			fmt.Println("OverheatLock happend")
-			time.Sleep(time.Second)
-		} else {
-			break
-		}
-	}
+	DataSignerGuard.Acquire(context.Background())
 }
 
 var OverheatUnlock = func() {
-	for {
-		if swapped := atomic.CompareAndSwapUint32(&dataSignerOverheat, 1, 0); !swapped {
-			fmt.Println("OverheatUnlock happend")
-			time.Sleep(time.Second)
-		} else {
-			break
-		}
-	}
+	DataSignerGuard.Release()
 }
 
 var DataSignerMd5 = func(data string) string {
@@ -47,7 +34,7 @@ var DataSignerMd5 = func(data string) string {
 	defer OverheatUnlock()
 	data += DataSignerSalt
 	dataHash := fmt.Sprintf("%x", md5.Sum([]byte(data)))
-	time.Sleep(10 * time.Millisecond)
+	SignerClock.Sleep(10 * time.Millisecond)
 	return dataHash
 }
 
@@ -55,6 +42,6 @@ var DataSignerCrc32 = func(data string) string {
 	data += DataSignerSalt
 	crcH := crc32.ChecksumIEEE([]byte(data))
 	dataHash := strconv.FormatUint(uint64(crcH), 10)
-	time.Sleep(time.Second)
+	SignerClock.Sleep(time.Second)
 	return dataHash
 }
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"io"
+	"reflect"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// infiniteSource отдает 0, 1, 2, ... пока конвейер не начнет останавливаться
+func infiniteSource(in, out chan interface{}) {
+	for i := 0; ; i++ {
+		select {
+		case out <- i:
+		case <-Stopping(out):
+			return
+		}
+	}
+}
+
+func TestPipelineDrain(t *testing.T) {
+	drain := make(chan struct{})
+	var (
+		taken   int32
+		got     []int
+		flushed bool
+	)
+	err := (&Pipeline{
+		Jobs: []job{
+			infiniteSource,
+			job(func(in, out chan interface{}) {
+				for v := range in {
+					if atomic.AddInt32(&taken, 1) == 3 {
+						close(drain)
+					}
+					time.Sleep(5 * time.Millisecond)
+					out <- v.(int) * 10
+				}
+			}),
+			job(func(in, out chan interface{}) {
+				for v := range in {
+					got = append(got, v.(int))
+				}
+				flushed = true
+			}),
+		},
+		Drain: drain,
+	}).Run()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	// все, что вторая стадия взяла, дошло до конца, и приемник дождался закрытия входа
+	if !flushed || len(got) != int(taken) || !reflect.DeepEqual(got[:3], []int{0, 10, 20}) {
+		t.Errorf("items lost while draining: taken %d, got %v, flushed %v", taken, got, flushed)
+	}
+}
+
+func TestPipelineDrainTimeout(t *testing.T) {
+	drain := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+
+	start := time.Now()
+	err := (&Pipeline{
+		Jobs: []job{
+			infiniteSource,
+			job(func(in, out chan interface{}) {
+				<-in
+				close(drain)
+				<-release
+			}),
+		},
+		Drain:        drain,
+		DrainTimeout: 20 * time.Millisecond,
+	}).Run()
+
+	if end := time.Since(start); end > time.Second {
+		t.Errorf("drain deadline not respected: %s", end)
+	}
+	derr, ok := err.(*DrainError)
+	if !ok || !reflect.DeepEqual(derr.Abandoned, []int{1}) {
+		t.Errorf("expected stage 1 to be abandoned, got %v", err)
+	}
+}
+
+func TestDrainOnSignal(t *testing.T) {
+	drain, abort, stop := DrainOnSignal(syscall.SIGUSR1)
+	defer stop()
+
+	syscall.Kill(syscall.Getpid(), syscall.SIGUSR1)
+	select {
+	case <-drain:
+	case <-time.After(time.Second):
+		t.Fatal("drain not triggered by signal")
+	}
+	select {
+	case <-abort:
+		t.Fatal("abort triggered by the first signal")
+	default:
+	}
+
+	syscall.Kill(syscall.Getpid(), syscall.SIGUSR1)
+	select {
+	case <-abort:
+	case <-time.After(time.Second):
+		t.Errorf("abort not triggered by second signal")
+	}
+}
+
+func TestPipelineDrainAbort(t *testing.T) {
+	drain, abort := make(chan struct{}), make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+
+	err := (&Pipeline{
+		Jobs: []job{
+			infiniteSource,
+			job(func(in, out chan interface{}) {
+				<-in
+				close(drain)
+				// источник успевает остановиться, а эта стадия - нет
+				time.Sleep(10 * time.Millisecond)
+				close(abort)
+				<-release
+			}),
+		},
+		Drain: drain,
+		Abort: abort,
+	}).Run()
+
+	derr, ok := err.(*DrainError)
+	if !ok || !reflect.DeepEqual(derr.Abandoned, []int{1}) {
+		t.Errorf("expected stage 1 to be abandoned, got %v", err)
+	}
+}
+
+func TestDrainIdleReader(t *testing.T) {
+	// источник ждет ввода, который никогда не придет; остановка не должна этого ждать
+	r, w := io.Pipe()
+	defer w.Close()
+	drain := make(chan struct{})
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(drain)
+	}()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- (&Pipeline{
+			Jobs: []job{
+				job(func(in, out chan interface{}) { readLines(r, out) }),
+				job(func(in, out chan interface{}) {
+					for range in {
+					}
+				}),
+			},
+			Drain: drain,
+		}).Run()
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("drain waits for idle reader")
+	}
+}
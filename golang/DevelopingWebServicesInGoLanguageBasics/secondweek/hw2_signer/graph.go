@@ -0,0 +1,209 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
+
+// Node - стадия графа, возвращается Graph.Add
+type Node int
+
+// Graph собирает конвейер произвольной формы (без циклов):
+// выход стадии можно раздать нескольким стадиям (Connect) или разбросать
+// по ним условием (Route), а стадия с несколькими входами получает их слияние
+type Graph struct {
+	nodes []*graphNode
+	err   error
+}
+
+type graphNode struct {
+	job   job
+	outs  []Node
+	route func(item interface{}) int
+	ins   int
+}
+
+func NewGraph() *Graph {
+	return &Graph{}
+}
+
+func (g *Graph) Add(j job) Node {
+	g.nodes = append(g.nodes, &graphNode{job: j})
+	return Node(len(g.nodes) - 1)
+}
+
+// Connect отправляет каждый элемент из from во все стадии to
+func (g *Graph) Connect(from Node, to ...Node) *Graph {
+	return g.link(from, nil, to)
+}
+
+// Route отправляет элемент из from в стадию to[route(item)];
+// элементы, для которых route вернул индекс вне to, отбрасываются
+func (g *Graph) Route(from Node, route func(item interface{}) int, to ...Node) *Graph {
+	if route == nil {
+		g.setErr(fmt.Errorf("graph: nil route for node %d", from))
+		return g
+	}
+	return g.link(from, route, to)
+}
+
+func (g *Graph) link(from Node, route func(interface{}) int, to []Node) *Graph {
+	if !g.valid(from) {
+		g.setErr(fmt.Errorf("graph: unknown node %d", from))
+		return g
+	}
+	n := g.nodes[from]
+	if len(n.outs) > 0 && (route != nil || n.route != nil) {
+		g.setErr(fmt.Errorf("graph: node %d already has routed outputs", from))
+		return g
+	}
+	for _, t := range to {
+		if !g.valid(t) {
+			g.setErr(fmt.Errorf("graph: unknown node %d", t))
+			return g
+		}
+		for _, existing := range n.outs {
+			if existing == t {
+				g.setErr(fmt.Errorf("graph: duplicate edge %d -> %d", from, t))
+				return g
+			}
+		}
+		n.outs = append(n.outs, t)
+		g.nodes[t].ins++
+	}
+	n.route = route
+	return g
+}
+
+func (g *Graph) valid(n Node) bool {
+	return n >= 0 && int(n) < len(g.nodes)
+}
+
+func (g *Graph) setErr(err error) {
+	if g.err == nil {
+		g.err = err
+	}
+}
+
+// Validate проверяет, что граф собран без ошибок и в нем нет циклов
+func (g *Graph) Validate() error {
+	if g.err != nil {
+		return g.err
+	}
+	if len(g.nodes) == 0 {
+		return errors.New("graph: no nodes")
+	}
+
+	const (
+		white = iota
+		grey
+		black
+	)
+	color := make([]int, len(g.nodes))
+	var visit func(n Node) error
+	visit = func(n Node) error {
+		color[n] = grey
+		for _, next := range g.nodes[n].outs {
+			switch color[next] {
+			case grey:
+				return fmt.Errorf("graph: cycle through nodes %d -> %d", n, next)
+			case white:
+				if err := visit(next); err != nil {
+					return err
+				}
+			}
+		}
+		color[n] = black
+		return nil
+	}
+	for n := range g.nodes {
+		if color[n] == white {
+			if err := visit(Node(n)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Run запускает все стадии, как ExecutePipeline, и ждет их завершения.
+// Вход стадии закрывается, когда закончились все стадии, которые в нее пишут.
+// Остаток входа стадии, которая закончилась раньше, выбрасывается.
+// Возвращает StageErrors, если какая-то стадия паниковала
+func (g *Graph) Run() error {
+	if err := g.Validate(); err != nil {
+		return err
+	}
+
+	ins := make([]chan interface{}, len(g.nodes))
+	writers := make([]*sync.WaitGroup, len(g.nodes))
+	for i, n := range g.nodes {
+		ins[i] = make(chan interface{}, 100)
+		writers[i] = &sync.WaitGroup{}
+		writers[i].Add(n.ins)
+	}
+
+	var (
+		mu   sync.Mutex
+		errs StageErrors
+	)
+	wg := &sync.WaitGroup{}
+	for i, n := range g.nodes {
+		wg.Add(3)
+		go func(i int) {
+			writers[i].Wait()
+			close(ins[i])
+			wg.Done()
+		}(i)
+
+		out := make(chan interface{}, 100)
+		go func(i int, n *graphNode, in chan interface{}) {
+			if r, stack := n.call(in, out); r != nil {
+				mu.Lock()
+				errs = append(errs, &StageError{Stage: i, Panic: r, Stack: stack})
+				mu.Unlock()
+			}
+			close(out)
+			// иначе стадии, которые пишут в этот вход, заблокировались бы навсегда
+			for range in {
+			}
+			wg.Done()
+		}(i, n, ins[i])
+
+		go func(n *graphNode) {
+			for item := range out {
+				switch {
+				case n.route != nil:
+					if idx := n.route(item); idx >= 0 && idx < len(n.outs) {
+						ins[n.outs[idx]] <- item
+					}
+				default:
+					for _, t := range n.outs {
+						ins[t] <- item
+					}
+				}
+			}
+			for _, t := range n.outs {
+				writers[t].Done()
+			}
+			wg.Done()
+		}(n)
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (n *graphNode) call(in, out chan interface{}) (r interface{}, stack []byte) {
+	defer func() {
+		if r = recover(); r != nil {
+			stack = debug.Stack()
+		}
+	}()
+	n.job(in, out)
+	return nil, nil
+}
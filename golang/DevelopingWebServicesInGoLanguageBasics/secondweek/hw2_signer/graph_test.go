@@ -0,0 +1,198 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func sourceOf(items ...int) job {
+	return func(in, out chan interface{}) {
+		for _, v := range items {
+			out <- v
+		}
+	}
+}
+
+func mapInts(f func(int) int) job {
+	return func(in, out chan interface{}) {
+		for v := range in {
+			out <- f(v.(int))
+		}
+	}
+}
+
+type intCollector struct {
+	mu    sync.Mutex
+	items []int
+}
+
+func (c *intCollector) collect(in, out chan interface{}) {
+	for v := range in {
+		c.mu.Lock()
+		c.items = append(c.items, v.(int))
+		c.mu.Unlock()
+	}
+}
+
+func (c *intCollector) sorted() []int {
+	sort.Ints(c.items)
+	return c.items
+}
+
+func TestGraphBroadcastMerge(t *testing.T) {
+	g := NewGraph()
+	src := g.Add(sourceOf(1, 2, 3))
+	double := g.Add(mapInts(func(v int) int { return v * 2 }))
+	negate := g.Add(mapInts(func(v int) int { return -v }))
+	sink := &intCollector{}
+	collect := g.Add(sink.collect)
+
+	g.Connect(src, double, negate)
+	g.Connect(double, collect)
+	g.Connect(negate, collect)
+	if err := g.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []int{-3, -2, -1, 2, 4, 6}
+	if got := sink.sorted(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", got, expected)
+	}
+}
+
+func TestGraphRoute(t *testing.T) {
+	g := NewGraph()
+	src := g.Add(sourceOf(1, 2, 3, 4, 5, -1))
+	even, odd := &intCollector{}, &intCollector{}
+	evenNode, oddNode := g.Add(even.collect), g.Add(odd.collect)
+
+	g.Route(src, func(item interface{}) int {
+		if item.(int) < 0 {
+			return -1
+		}
+		return item.(int) % 2
+	}, evenNode, oddNode)
+	if err := g.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := even.sorted(); !reflect.DeepEqual(got, []int{2, 4}) {
+		t.Errorf("even branch: %v", got)
+	}
+	if got := odd.sorted(); !reflect.DeepEqual(got, []int{1, 3, 5}) {
+		t.Errorf("odd branch: %v", got)
+	}
+}
+
+// runGraph запускает граф и падает, если он не завершился
+func runGraph(t *testing.T, g *Graph) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- g.Run()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(2 * time.Second):
+		t.Fatal("graph did not finish")
+	}
+	return nil
+}
+
+func TestGraphEarlyReturn(t *testing.T) {
+	items := make([]int, 500)
+	for i := range items {
+		items[i] = i
+	}
+	g := NewGraph()
+	src := g.Add(sourceOf(items...))
+	// ветка берет один элемент и заканчивается, не мешая второй получить все
+	first := g.Add(func(in, out chan interface{}) {
+		<-in
+	})
+	sink := &intCollector{}
+	all := g.Add(sink.collect)
+	g.Connect(src, first, all)
+	if err := runGraph(t, g); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := sink.sorted(); !reflect.DeepEqual(got, items) {
+		t.Errorf("results not match\nGot %d items\nExpected: %d", len(got), len(items))
+	}
+}
+
+func TestGraphPanic(t *testing.T) {
+	g := NewGraph()
+	src := g.Add(sourceOf(1, 2, 3))
+	broken := g.Add(func(in, out chan interface{}) {
+		<-in
+		panic("broken node")
+	})
+	sink := &intCollector{}
+	collect := g.Add(sink.collect)
+	g.Connect(src, broken, collect)
+
+	err := runGraph(t, g)
+	errs, ok := err.(StageErrors)
+	if !ok || len(errs) != 1 || errs[0].Stage != int(broken) || errs[0].Panic != "broken node" {
+		t.Fatalf("expected stage error for node %d, got %v", broken, err)
+	}
+	if got := sink.sorted(); !reflect.DeepEqual(got, []int{1, 2, 3}) {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", got, []int{1, 2, 3})
+	}
+}
+
+func TestGraphSigner(t *testing.T) {
+	withFastSigners(t)
+
+	var res string
+	g := NewGraph()
+	src := g.Add(sourceOf(0, 1))
+	single := g.Add(SingleHash)
+	multi := g.Add(MultiHash)
+	combineNode := g.Add(CombineResults)
+	sink := g.Add(func(in, out chan interface{}) {
+		res = (<-in).(string)
+	})
+	g.Connect(src, single).Connect(single, multi).Connect(multi, combineNode).Connect(combineNode, sink)
+	if err := g.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := runSigner(NewSigner(), 0, 1); res != expected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", res, expected)
+	}
+}
+
+func TestGraphValidate(t *testing.T) {
+	g := NewGraph()
+	a, b, c := g.Add(sourceOf()), g.Add(sourceOf()), g.Add(sourceOf())
+	g.Connect(a, b).Connect(b, c).Connect(c, a)
+	if err := g.Run(); err == nil {
+		t.Errorf("expected cycle error")
+	}
+
+	g = NewGraph()
+	a = g.Add(sourceOf())
+	g.Connect(a, a)
+	if err := g.Validate(); err == nil {
+		t.Errorf("expected self-loop error")
+	}
+
+	g = NewGraph()
+	a, b = g.Add(sourceOf()), g.Add(sourceOf())
+	g.Connect(a, b).Route(a, func(interface{}) int { return 0 }, b)
+	if err := g.Validate(); err == nil {
+		t.Errorf("expected error for mixed connect and route")
+	}
+
+	g = NewGraph()
+	g.Connect(g.Add(sourceOf()), Node(5))
+	if err := g.Validate(); err == nil {
+		t.Errorf("expected unknown node error")
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/md5"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type signerCalls struct {
+	md5   uint32
+	crc32 uint32
+}
+
+// withFastSigners подменяет DataSigner* на версии без задержек, которые считают вызовы
+func withFastSigners(t *testing.T) *signerCalls {
+	calls := &signerCalls{}
+	oldMd5, oldCrc32 := DataSignerMd5, DataSignerCrc32
+	DataSignerMd5 = func(data string) string {
+		atomic.AddUint32(&calls.md5, 1)
+		return fmt.Sprintf("%x", md5.Sum([]byte(data+DataSignerSalt)))
+	}
+	DataSignerCrc32 = func(data string) string {
+		atomic.AddUint32(&calls.crc32, 1)
+		return strconv.FormatUint(uint64(crc32.ChecksumIEEE([]byte(data+DataSignerSalt))), 10)
+	}
+	t.Cleanup(func() {
+		DataSignerMd5, DataSignerCrc32 = oldMd5, oldCrc32
+	})
+	return calls
+}
+
+// runSigner прогоняет inputData через SingleHash, MultiHash и CombineResults
+func runSigner(s *Signer, inputData ...interface{}) string {
+	var res string
+	ExecutePipeline(
+		job(func(in, out chan interface{}) {
+			for _, data := range inputData {
+				out <- data
+			}
+		}),
+		job(s.SingleHash),
+		job(s.MultiHash),
+		job(CombineResults),
+		job(func(in, out chan interface{}) {
+			res = (<-in).(string)
+		}),
+	)
+	return res
+}
+
+// checkGoroutineLeaks после теста проверяет, что не осталось горутин,
+// запущенных кодом пакета (стадий, relay и воркеров), которых не было до теста
+func checkGoroutineLeaks(t *testing.T) {
+	before := packageGoroutines()
+	t.Cleanup(func() {
+		var leaked []string
+		deadline := time.Now().Add(time.Second)
+		for {
+			leaked = leaked[:0]
+			for id, stack := range packageGoroutines() {
+				if _, ok := before[id]; !ok {
+					leaked = append(leaked, stack)
+				}
+			}
+			if len(leaked) == 0 || time.Now().After(deadline) {
+				break
+			}
+			// горутина могла уже все сделать, но еще не выйти
+			time.Sleep(time.Millisecond)
+		}
+		for _, stack := range leaked {
+			t.Errorf("leaked goroutine:\n%s", stack)
+		}
+	})
+}
+
+// packageGoroutines - стеки живых горутин, запущенных из пакета, по их номерам
+func packageGoroutines() map[string]string {
+	res := make(map[string]string)
+	for _, stack := range strings.Split(string(goroutineStacks()), "\n\n") {
+		header := strings.Fields(stack)
+		if len(header) < 2 || header[0] != "goroutine" {
+			continue
+		}
+		if strings.Contains(stack, "\ncreated by hw2_signer.") {
+			res[header[1]] = stack
+		}
+	}
+	return res
+}
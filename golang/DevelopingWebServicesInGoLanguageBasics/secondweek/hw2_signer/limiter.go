@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limiter охраняет дорогой ресурс: не больше Concurrency одновременных
+// вызовов и не больше одного вызова за Interval (с запасом Burst)
+type Limiter struct {
+	sem chan struct{}
+
+	mu       sync.Mutex
+	interval time.Duration
+	burst    int
+	tokens   float64
+	last     time.Time
+}
+
+// NewLimiter создает ограничитель; concurrency <= 0 и interval <= 0 означают "без ограничения"
+func NewLimiter(concurrency int, interval time.Duration, burst int) *Limiter {
+	l := &Limiter{
+		interval: interval,
+		burst:    burst,
+	}
+	if concurrency > 0 {
+		l.sem = make(chan struct{}, concurrency)
+	}
+	if l.burst < 1 {
+		l.burst = 1
+	}
+	l.tokens = float64(l.burst)
+	return l
+}
+
+func (l *Limiter) Acquire() {
+	l.AcquireContext(context.Background())
+}
+
+// AcquireContext - Acquire, который сдается, если ctx отменили раньше, чем подошла очередь
+func (l *Limiter) AcquireContext(ctx context.Context) error {
+	if l.sem != nil {
+		select {
+		case l.sem <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if l.interval > 0 {
+		if wait := l.reserve(); wait > 0 {
+			timer := time.NewTimer(wait)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				l.refund()
+				l.Release()
+				return ctx.Err()
+			}
+		}
+	}
+	return nil
+}
+
+// Settings - параметры, с которыми создан ограничитель (см. NewLimiter)
+func (l *Limiter) Settings() (concurrency int, interval time.Duration, burst int) {
+	return cap(l.sem), l.interval, l.burst
+}
+
+func (l *Limiter) Release() {
+	if l.sem != nil {
+		<-l.sem
+	}
+}
+
+// reserve забирает токен из ведра и возвращает сколько нужно подождать до его появления
+func (l *Limiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if !l.last.IsZero() {
+		l.tokens += float64(now.Sub(l.last)) / float64(l.interval)
+		if l.tokens > float64(l.burst) {
+			l.tokens = float64(l.burst)
+		}
+	}
+	l.last = now
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens * float64(l.interval))
+}
+
+// refund возвращает в ведро токен, который reserve отдал не дождавшемуся вызову
+func (l *Limiter) refund() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.tokens++; l.tokens > float64(l.burst) {
+		l.tokens = float64(l.burst)
+	}
+}
+
+// Guard оборачивает функцию так, что каждый ее вызов проходит через ограничитель
+func (l *Limiter) Guard(f func(string) string) func(string) string {
+	return func(data string) string {
+		l.Acquire()
+		defer l.Release()
+		return f(data)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLimiterConcurrency(t *testing.T) {
+	var (
+		current int32
+		maxSeen int32
+	)
+	l := NewLimiter(2, 0, 0)
+	f := l.Guard(func(data string) string {
+		n := atomic.AddInt32(&current, 1)
+		for {
+			m := atomic.LoadInt32(&maxSeen)
+			if n <= m || atomic.CompareAndSwapInt32(&maxSeen, m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&current, -1)
+		return data
+	})
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			f("x")
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+
+	if maxSeen != 2 {
+		t.Errorf("concurrency not limited\nGot: %d\nExpected: 2", maxSeen)
+	}
+}
+
+func TestLimiterRate(t *testing.T) {
+	l := NewLimiter(0, 20*time.Millisecond, 1)
+	f := l.Guard(func(data string) string { return data })
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		f("x")
+	}
+	end := time.Since(start)
+
+	// первый вызов проходит сразу, остальные ждут по интервалу
+	if expected := 80 * time.Millisecond; end < expected {
+		t.Errorf("rate not limited\nGot: %s\nExpected: >=%s", end, expected)
+	}
+}
+
+func TestLimiterAcquireContext(t *testing.T) {
+	l := NewLimiter(1, 0, 0)
+	l.Acquire()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.AcquireContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline error, got %v", err)
+	}
+
+	l.Release()
+	if err := l.AcquireContext(context.Background()); err != nil {
+		t.Errorf("acquire after release failed: %v", err)
+	}
+}
+
+func TestLimiterAcquireContextRefund(t *testing.T) {
+	l := NewLimiter(0, 50*time.Millisecond, 1)
+	l.Acquire()
+
+	// сдавшиеся вызовы не должны отодвигать очередь остальных
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+		if err := l.AcquireContext(ctx); err != context.DeadlineExceeded {
+			t.Errorf("expected deadline error, got %v", err)
+		}
+		cancel()
+	}
+	start := time.Now()
+	l.Acquire()
+	if waited := time.Since(start); waited > 45*time.Millisecond {
+		t.Errorf("cancelled acquires kept their tokens: waited %s", waited)
+	}
+}
@@ -1,38 +1,255 @@
 package main
 
 import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
+// подписывает строки из stdin, файлов или числового диапазона:
+//	hw2_signer -range 0:10 -parallel 4 -format json
+//	hw2_signer -salt pepper users.txt
+// или работает удаленным воркером для других запусков:
+//	hw2_signer -worker :7001
+//	hw2_signer -workers host1:7001,host2:7001 -range 0:100
+// или HTTP сервисом (см. SignServer):
+//	hw2_signer -http :8080 -parallel 16
 func main() {
-	// var res string
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+type signed struct {
+	Input  string `json:"input"`
+	Single string `json:"single_hash"`
+	Multi  string `json:"multi_hash"`
+	// Error - почему элемент не подписан (только в ответах SignServer)
+	Error string `json:"error,omitempty"`
+}
+
+type cliConfig struct {
+	files      []string
+	from, to   int
+	hasRange   bool
+	parallel   int
+	format     string
+	drain      time.Duration
+	checkpoint string
+	worker     string
+	workers    []string
+	http       string
+}
+
+func parseArgs(args []string, s *Signer) (*cliConfig, error) {
+	cfg := &cliConfig{}
+	var (
+		rangeFlag    string
+		workersFlag  string
+		singleRecipe string
+		multiRecipe  string
+	)
+	fs := flag.NewFlagSet("hw2_signer", flag.ContinueOnError)
+	fs.StringVar(&rangeFlag, "range", "", "sign integers from:to (to not included) instead of reading lines")
+	fs.IntVar(&cfg.parallel, "parallel", 8, "max items signed at the same time")
+	fs.StringVar(&s.Salt, "salt", s.Salt, "salt appended to data before signing")
+	fs.StringVar(&cfg.format, "format", "text", "output format: text or json")
+	fs.StringVar(&cfg.checkpoint, "checkpoint", "", "file to log signed items to and skip them on rerun")
+	fs.StringVar(&cfg.worker, "worker", "", "serve as a remote signer worker on this address")
+	fs.StringVar(&cfg.http, "http", "", "serve the signing HTTP API on this address")
+	fs.StringVar(&workersFlag, "workers", "", "comma separated remote worker addresses to sign on")
+	fs.DurationVar(&cfg.drain, "drain-timeout", 0, "how long to finish signed items after SIGINT/SIGTERM (0 - no limit, a second signal stops at once)")
+	fs.StringVar(&singleRecipe, "single-recipe", SingleHashRecipe, "SingleHash recipe")
+	fs.StringVar(&multiRecipe, "multi-recipe", MultiHashRecipe, "MultiHash recipe")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	cfg.files = fs.Args()
+	if workersFlag != "" {
+		cfg.workers = strings.Split(workersFlag, ",")
+	}
+
+	if cfg.format != "text" && cfg.format != "json" {
+		return nil, fmt.Errorf("unknown format %q", cfg.format)
+	}
+	if cfg.parallel < 1 {
+		return nil, errors.New("parallel must be positive")
+	}
+	if rangeFlag != "" {
+		if len(cfg.files) > 0 {
+			return nil, errors.New("range and files can't be used together")
+		}
+		parts := strings.SplitN(rangeFlag, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("bad range %q, expected from:to", rangeFlag)
+		}
+		var err1, err2 error
+		cfg.from, err1 = strconv.Atoi(parts[0])
+		cfg.to, err2 = strconv.Atoi(parts[1])
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("bad range %q, expected from:to", rangeFlag)
+		}
+		cfg.hasRange = true
+	}
+
+	var err error
+	if s.SingleRecipe, err = ParseRecipe(singleRecipe); err != nil {
+		return nil, err
+	}
+	if s.MultiRecipe, err = ParseRecipe(multiRecipe); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	s := NewSigner()
+	cfg, err := parseArgs(args, s)
+	if err != nil {
+		return err
+	}
+
+	if cfg.worker != "" {
+		l, err := net.Listen("tcp", cfg.worker)
+		if err != nil {
+			return err
+		}
+		return NewSignerServer(s).Serve(l)
+	}
+	if cfg.http != "" {
+		srv := NewSignServer(s)
+		srv.MaxConcurrent = cfg.parallel
+		return srv.HTTPServer(cfg.http).ListenAndServe()
+	}
+
+	singleHash := func(data string) (string, error) { return s.SingleHashOf(data), nil }
+	multiHash := func(data string) (string, error) { return s.MultiHashOf(data), nil }
+	if len(cfg.workers) > 0 {
+		pool := NewWorkerPool(cfg.workers...)
+		pool.Options = s.SignOptions()
+		pool.Start()
+		defer pool.Close()
+		singleHash, multiHash = pool.SingleHashOf, pool.MultiHashOf
+	}
+
+	var cp *Checkpoint
+	if cfg.checkpoint != "" {
+		if cp, err = OpenCheckpoint(cfg.checkpoint, s.CheckpointParams()); err != nil {
+			return err
+		}
+		defer cp.Close()
+	}
+
+	var readErr, writeErr error
+	w := bufio.NewWriter(stdout)
+	enc := json.NewEncoder(w)
+	hashes := make([]string, 0, 100)
+	// wMu защищает w от брошенного после DrainError приемника
+	var (
+		wMu      sync.Mutex
+		wStopped bool
+	)
 
-	inputData := []int{0, 1}
+	drain, abort, stopSignals := DrainOnSignal(os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
 
-	hashSignJobs := []job{
+	pipeline := &Pipeline{Drain: drain, Abort: abort, DrainTimeout: cfg.drain}
+	pipeline.Jobs = []job{
 		job(func(in, out chan interface{}) {
-			for _, fibNum := range inputData {
-				fmt.Println(fibNum)
-				out <- fibNum
+			readErr = cfg.readInputs(stdin, out)
+		}),
+		OrderedMap(cfg.parallel, cfg.parallel, func(rawData interface{}) interface{} {
+			data := fmt.Sprint(rawData)
+			var item signed
+			if cp != nil {
+				if ok, err := cp.Lookup(data, &item); ok && err == nil {
+					return item
+				}
+			}
+			single, err := singleHash(data)
+			if err != nil {
+				panic(err)
+			}
+			multi, err := multiHash(single)
+			if err != nil {
+				panic(err)
 			}
-			// close(out)
+			item = signed{Input: data, Single: single, Multi: multi}
+			if cp != nil {
+				cp.saveOrRemember(data, item)
+			}
+			return item
 		}),
-		job(SingleHash),
-		job(MultiHash),
-		job(CombineResults),
 		job(func(in, out chan interface{}) {
-			dataRaw := <-in
-			data, ok := dataRaw.(string)
-			fmt.Println(data)
-			if !ok {
-				panic("cant convert result data to string")
+			for rawData := range in {
+				item := rawData.(signed)
+				hashes = append(hashes, item.Multi)
+				wMu.Lock()
+				if writeErr == nil && !wStopped {
+					if cfg.format == "json" {
+						writeErr = enc.Encode(item)
+					} else {
+						_, writeErr = fmt.Fprintf(w, "%s\t%s\t%s\n", item.Input, item.Single, item.Multi)
+					}
+				}
+				wMu.Unlock()
 			}
-			// res = data
 		}),
 	}
+	// после остановки по сигналу выводим то, что успели подписать. При ошибке
+	// стадии могут еще работать: отдаем уже записанное, а combined не выводим
+	if err = pipeline.Run(); err != nil {
+		wMu.Lock()
+		wStopped = true
+		w.Flush()
+		wMu.Unlock()
+		return err
+	}
+	if readErr != nil {
+		return readErr
+	}
+	if writeErr != nil {
+		return writeErr
+	}
+	if cp != nil && cp.Err() != nil {
+		return cp.Err()
+	}
 
+	if cfg.format == "json" {
+		err = enc.Encode(map[string]string{"combined": combine(hashes)})
+	} else {
+		_, err = fmt.Fprintf(w, "combined\t%s\n", combine(hashes))
+	}
+	if err != nil {
+		return err
+	}
+	return w.Flush()
+}
 
-	ExecutePipeline(hashSignJobs...)
-
-	// time.Sleep(50 * time.Second)
+func (cfg *cliConfig) readInputs(stdin io.Reader, out chan interface{}) error {
+	if cfg.hasRange {
+		for i := cfg.from; i < cfg.to; i++ {
+			if !send(out, i) {
+				break
+			}
+		}
+		return nil
+	}
+	if len(cfg.files) == 0 {
+		return readLines(stdin, out)
+	}
+	src := NewLinesSource(cfg.files...)
+	src.Run(nil, out)
+	return src.Err()
 }
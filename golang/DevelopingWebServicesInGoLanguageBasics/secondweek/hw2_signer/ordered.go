@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+type seqItem struct {
+	seq   int
+	value interface{}
+	// skip - обработка элемента упала, в out он не попадает
+	skip bool
+}
+
+// OrderedMap параллельно применяет f к элементам in, но отдает результаты в порядке поступления.
+// window ограничивает число элементов, взятых из in, но еще не отданных в out -
+// один медленный элемент не даст накопить за собой больше window готовых результатов
+func OrderedMap(workers, window int, f func(interface{}) interface{}) job {
+	if window < 1 {
+		window = 1
+	}
+	if workers < 1 {
+		workers = window
+	}
+	return func(in, out chan interface{}) {
+		tokens := make(chan struct{}, window)
+		tasks := make(chan seqItem)
+		results := make(chan seqItem, window)
+
+		wg := &sync.WaitGroup{}
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				for t := range tasks {
+					results <- orderedApply(f, t, out)
+				}
+				wg.Done()
+			}()
+		}
+
+		go func() {
+			seq := 0
+			for v := range in {
+				tokens <- struct{}{}
+				tasks <- seqItem{seq: seq, value: v}
+				seq++
+			}
+			close(tasks)
+			wg.Wait()
+			close(results)
+		}()
+
+		pending := make(map[int]seqItem, window)
+		next := 0
+		for r := range results {
+			pending[r.seq] = r
+			for {
+				v, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				if !v.skip {
+					out <- v.value
+				}
+				<-tokens
+				next++
+			}
+		}
+	}
+}
+
+func orderedApply(f func(interface{}) interface{}, t seqItem, out chan interface{}) (res seqItem) {
+	res = seqItem{seq: t.seq, skip: true}
+	defer RecoverItem(out, t.value)
+	return seqItem{seq: t.seq, value: f(t.value)}
+}
+
+// OrderedSingleHash - SingleHash, сохраняющий порядок входных данных
+func (s *Signer) OrderedSingleHash(window int) job {
+	return OrderedMap(window, window, func(rawData interface{}) interface{} {
+		return s.SingleHashOf(fmt.Sprint(rawData))
+	})
+}
+
+// OrderedMultiHash - MultiHash, сохраняющий порядок входных данных
+func (s *Signer) OrderedMultiHash(window int) job {
+	return OrderedMap(window, window, func(rawData interface{}) interface{} {
+		return s.MultiHashOf(rawData.(string))
+	})
+}
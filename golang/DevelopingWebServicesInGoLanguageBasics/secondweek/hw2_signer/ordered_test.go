@@ -0,0 +1,63 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOrderedMap(t *testing.T) {
+	var got []interface{}
+	ExecutePipeline(
+		job(func(in, out chan interface{}) {
+			for i := 0; i < 10; i++ {
+				out <- i
+			}
+		}),
+		OrderedMap(4, 3, func(v interface{}) interface{} {
+			// первые элементы считаются дольше последних
+			time.Sleep(time.Duration(10-v.(int)) * time.Millisecond)
+			return v.(int) * 2
+		}),
+		job(func(in, out chan interface{}) {
+			for v := range in {
+				got = append(got, v)
+			}
+		}),
+	)
+
+	expected := []interface{}{0, 2, 4, 6, 8, 10, 12, 14, 16, 18}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("order not preserved\nGot: %v\nExpected: %v", got, expected)
+	}
+}
+
+func TestOrderedSigner(t *testing.T) {
+	withFastSigners(t)
+	s := NewSigner()
+
+	var got []interface{}
+	ExecutePipeline(
+		job(func(in, out chan interface{}) {
+			for _, v := range []int{5, 3, 1} {
+				out <- v
+			}
+		}),
+		s.OrderedSingleHash(2),
+		s.OrderedMultiHash(2),
+		job(func(in, out chan interface{}) {
+			for v := range in {
+				got = append(got, v)
+			}
+		}),
+	)
+
+	expected := []interface{}{
+		s.MultiHashOf(s.SingleHashOf("5")),
+		s.MultiHashOf(s.SingleHashOf("3")),
+		s.MultiHashOf(s.SingleHashOf("1")),
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("order not preserved\nGot: %v\nExpected: %v", got, expected)
+	}
+}
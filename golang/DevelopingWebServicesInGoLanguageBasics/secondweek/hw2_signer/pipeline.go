@@ -0,0 +1,477 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type ErrorMode int
+
+const (
+	// FailFast - после первой паники стадии перестают получать новые элементы,
+	// конвейер доделывает то, что уже взято, и Run возвращает ошибку
+	FailFast ErrorMode = iota
+	// SkipItem - элемент, на котором случилась паника, пропускается, остальные обрабатываются.
+	// Стадия, упавшая вне RecoverItem, запускается заново и теряет все, что держала в локальных
+	// переменных, поэтому стадии с состоянием (OrderedMap, CombineResultsWindowed) ловят панику
+	// на каждом элементе через RecoverItem
+	SkipItem
+)
+
+// StageError - паника внутри стадии конвейера или ее воркера
+type StageError struct {
+	Stage int
+	// Item - элемент, на котором упал воркер, или последний элемент,
+	// который стадия взяла из входа до паники (nil - стадия ничего не успела взять)
+	Item  interface{}
+	Panic interface{}
+	Stack []byte
+}
+
+func (e *StageError) Error() string {
+	return fmt.Sprintf("stage %d panicked on item %v: %v", e.Stage, e.Item, e.Panic)
+}
+
+// StageErrors - все ошибки, пойманные за время работы конвейера
+type StageErrors []*StageError
+
+func (errs StageErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// DrainError - конвейер не успел доработать за DrainTimeout
+type DrainError struct {
+	// Abandoned - номера стадий, которые еще работали, когда истек DrainTimeout
+	Abandoned []int
+	// Discarded - сколько элементов источника выброшено после начала остановки
+	Discarded int64
+	Errs      StageErrors
+}
+
+func (e *DrainError) Error() string {
+	msg := fmt.Sprintf("drain timed out: stages %v abandoned, %d source items discarded", e.Abandoned, e.Discarded)
+	if len(e.Errs) > 0 {
+		msg += "; " + e.Errs.Error()
+	}
+	return msg
+}
+
+// Pipeline - ExecutePipeline с настройками
+type Pipeline struct {
+	Jobs []job
+	Mode ErrorMode
+	// Drain, когда закрывается, плавно останавливает конвейер: вторая стадия больше
+	// не получает элементы от источника, а остальные доделывают то, что уже взяли
+	Drain <-chan struct{}
+	// DrainTimeout - сколько ждать стадии после начала остановки; 0 - сколько потребуется
+	DrainTimeout time.Duration
+	// Abort, когда закрывается после начала остановки, прекращает ждать стадии,
+	// как если бы истек DrainTimeout
+	Abort <-chan struct{}
+	// StallTimeout - отладочный режим: если за это время ни один элемент не прошел
+	// между стадиями и ни одна стадия не завершилась, Run печатает в StallOutput, кто
+	// на чем заблокирован, со стеками горутин и возвращает StallError. 0 - не следить
+	StallTimeout time.Duration
+	// StallOutput - куда печатать отчет о зависании, nil - os.Stderr
+	StallOutput io.Writer
+	// Priority, если задан, превращает очередь перед каждой стадией в очередь с приоритетами:
+	// стадия получает сначала элементы с большим Priority(item), при равных - по порядку
+	Priority func(item interface{}) int
+	// Aging защищает от голодания: каждые Aging ожидания в очереди прибавляют элементу
+	// единицу приоритета. 0 - приоритет не растет
+	Aging time.Duration
+	// QueueSize - сколько элементов очередь с приоритетами забирает у предыдущей стадии
+	// наперед, выбирая из них; 0 - 100
+	QueueSize int
+}
+
+type stageState struct {
+	index int
+	p     *pipelineRun
+
+	done      chan struct{}
+	sync      chan struct{}
+	relayDone chan struct{}
+	// drain - остановка, после которой relay перестает брать элементы (только у второй стадии)
+	drain <-chan struct{}
+	out   chan interface{}
+
+	mu    sync.Mutex
+	last  interface{}
+	taken int
+	// holding - в очереди relay есть элементы, которые стадия еще не забрала
+	holding bool
+}
+
+type pipelineRun struct {
+	mode ErrorMode
+
+	mu     sync.Mutex
+	errs   StageErrors
+	stop   chan struct{}
+	failed bool
+
+	halting   chan struct{}
+	haltOnce  sync.Once
+	discarded int64
+	// progress растет, когда элемент переходит между стадиями или стадия завершается
+	progress int64
+}
+
+// outs каждой стадии известны воркерам через RecoverItem
+var stageByOut sync.Map
+
+// Run запускает стадии, как ExecutePipeline, и ловит паники в них.
+// Возвращает StageErrors, если была хотя бы одна паника
+func (p *Pipeline) Run() error {
+	run := &pipelineRun{
+		mode:    p.Mode,
+		stop:    make(chan struct{}),
+		halting: make(chan struct{}),
+	}
+	drain := make(chan struct{})
+	if p.Drain != nil {
+		go func() {
+			select {
+			case <-p.Drain:
+				run.halt()
+				close(drain)
+			case <-run.halting:
+			}
+		}()
+	}
+
+	wg := &sync.WaitGroup{}
+	stages := make([]*stageState, len(p.Jobs))
+	in := make(chan interface{})
+	close(in)
+	for i, j := range p.Jobs {
+		out := make(chan interface{}, 100)
+		st := &stageState{
+			index:     i,
+			p:         run,
+			done:      make(chan struct{}),
+			sync:      make(chan struct{}),
+			relayDone: make(chan struct{}),
+			out:       out,
+		}
+		if i == 1 {
+			st.drain = drain
+		}
+		stages[i] = st
+		stageByOut.Store(out, st)
+
+		stageIn := in
+		if i > 0 {
+			stageIn = make(chan interface{})
+			go st.relay(in, stageIn, p.queue())
+		} else {
+			close(st.relayDone)
+		}
+
+		wg.Add(1)
+		go func(j job, in, out chan interface{}) {
+			st.run(j, in, out)
+			stageByOut.Delete(out)
+			close(out)
+			atomic.AddInt64(&run.progress, 1)
+			wg.Done()
+		}(j, stageIn, out)
+		in = out
+	}
+	// выход последней стадии никто не читает
+	sinkDone := make(chan struct{})
+	go func(out chan interface{}) {
+		defer close(sinkDone)
+		for range out {
+			atomic.AddInt64(&run.progress, 1)
+		}
+	}(in)
+
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+	var deadline <-chan time.Time
+	var abort <-chan struct{}
+	var stallCheck <-chan time.Time
+	if p.StallTimeout > 0 {
+		ticker := time.NewTicker(p.StallTimeout / 4)
+		defer ticker.Stop()
+		stallCheck = ticker.C
+	}
+	lastProgress, lastProgressAt := int64(-1), time.Now()
+	for {
+		select {
+		case <-finished:
+			run.halt()
+			// после Run не должно остаться горутин конвейера
+			for _, st := range stages {
+				<-st.relayDone
+			}
+			<-sinkDone
+			if errs := run.errors(); len(errs) > 0 {
+				return errs
+			}
+			return nil
+		case <-drain:
+			drain = nil
+			abort = p.Abort
+			if p.DrainTimeout > 0 {
+				timer := time.NewTimer(p.DrainTimeout)
+				defer timer.Stop()
+				deadline = timer.C
+			}
+		case <-abort:
+			return run.abandon(stages)
+		case <-deadline:
+			return run.abandon(stages)
+		case now := <-stallCheck:
+			if progress := atomic.LoadInt64(&run.progress); progress != lastProgress {
+				lastProgress, lastProgressAt = progress, now
+				continue
+			}
+			if now.Sub(lastProgressAt) < p.StallTimeout {
+				continue
+			}
+			err := newStallError(stages, now.Sub(lastProgressAt))
+			output := p.StallOutput
+			if output == nil {
+				output = os.Stderr
+			}
+			err.Dump(output)
+			return err
+		}
+	}
+}
+
+// abandon - DrainError со стадиями, которые еще работают
+func (run *pipelineRun) abandon(stages []*stageState) error {
+	err := &DrainError{
+		Discarded: atomic.LoadInt64(&run.discarded),
+		Errs:      run.errors(),
+	}
+	for _, st := range stages {
+		select {
+		case <-st.done:
+		default:
+			err.Abandoned = append(err.Abandoned, st.index)
+		}
+	}
+	return err
+}
+
+// queue - очередь перед стадией; без Priority relay держит по одному элементу, как канал
+func (p *Pipeline) queue() *stageQueue {
+	if p.Priority == nil {
+		return newStageQueue(1, nil, 0)
+	}
+	size := p.QueueSize
+	if size <= 0 {
+		size = 100
+	}
+	return newStageQueue(size, p.Priority, p.Aging)
+}
+
+// relay передает элементы в стадию через ее очередь и запоминает последний взятый ею элемент.
+// Если стадия закончила работу или конвейер остановлен, остаток входа выбрасывается,
+// чтобы не блокировать предыдущие стадии
+func (st *stageState) relay(src, dst chan interface{}, queue *stageQueue) {
+	draining, closed := false, false
+	defer close(st.relayDone)
+	defer func() {
+		if draining {
+			atomic.AddInt64(&st.p.discarded, int64(queue.Len()))
+		}
+		for range src {
+			if draining {
+				atomic.AddInt64(&st.p.discarded, 1)
+			}
+		}
+	}()
+	defer close(dst)
+
+	for {
+		recv, send := src, dst
+		if closed || queue.full() {
+			recv = nil
+		}
+		var item interface{}
+		if queue.Len() > 0 {
+			item = queue.peek()
+		} else {
+			send = nil
+		}
+		if recv == nil && send == nil {
+			// вход закрыт и очередь пуста
+			return
+		}
+		select {
+		case v, ok := <-recv:
+			if !ok {
+				closed = true
+				continue
+			}
+			queue.put(v)
+			st.mu.Lock()
+			st.holding = true
+			st.mu.Unlock()
+			atomic.AddInt64(&st.p.progress, 1)
+		case send <- item:
+			queue.take()
+			st.mu.Lock()
+			st.last = item
+			st.taken++
+			st.holding = queue.Len() > 0
+			st.mu.Unlock()
+			atomic.AddInt64(&st.p.progress, 1)
+		case <-st.sync:
+		case <-st.done:
+			return
+		case <-st.p.stop:
+			return
+		case <-st.drain:
+			draining = true
+			return
+		}
+	}
+}
+
+// lastItem возвращает последний элемент, взятый стадией, и сколько всего элементов она взяла
+func (st *stageState) lastItem() (interface{}, int) {
+	// ждем, пока relay допишет элемент, который стадия могла только что забрать
+	select {
+	case st.sync <- struct{}{}:
+	case <-st.relayDone:
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.last, st.taken
+}
+
+func (st *stageState) run(j job, in, out chan interface{}) {
+	defer close(st.done)
+	prevTaken := 0
+	for {
+		r, stack := st.call(j, in, out)
+		if r == nil {
+			return
+		}
+		item, taken := st.lastItem()
+		st.p.report(&StageError{Stage: st.index, Item: item, Panic: r, Stack: stack})
+		// стадию перезапускаем, только если она успела взять новый элемент,
+		// иначе паникующая на старте стадия крутилась бы вечно
+		if st.p.mode != SkipItem || taken == prevTaken {
+			return
+		}
+		prevTaken = taken
+	}
+}
+
+func (st *stageState) call(j job, in, out chan interface{}) (r interface{}, stack []byte) {
+	defer func() {
+		if r = recover(); r != nil {
+			stack = debug.Stack()
+		}
+	}()
+	j(in, out)
+	return nil, nil
+}
+
+func (run *pipelineRun) report(err *StageError) {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	run.errs = append(run.errs, err)
+	if run.mode == FailFast && !run.failed {
+		run.failed = true
+		close(run.stop)
+		run.halt()
+	}
+}
+
+func (run *pipelineRun) errors() StageErrors {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	return run.errs
+}
+
+func (run *pipelineRun) halt() {
+	run.haltOnce.Do(func() {
+		close(run.halting)
+	})
+}
+
+// Stopping возвращает канал, который закрывается, когда конвейер, в котором работает
+// стадия с выходом out, начал останавливаться. Источники должны следить за ним:
+//	select {
+//	case out <- item:
+//	case <-Stopping(out):
+//		return
+//	}
+// Вне Pipeline канал никогда не закрывается
+func Stopping(out chan interface{}) <-chan struct{} {
+	st, ok := stageByOut.Load(out)
+	if !ok {
+		return nil
+	}
+	return st.(*stageState).p.halting
+}
+
+// DrainOnSignal возвращает каналы для Pipeline.Drain и Pipeline.Abort: первый
+// закрывается при получении одного из сигналов, второй - при повторном сигнале,
+// и функцию, прекращающую слежение за сигналами
+func DrainOnSignal(sigs ...os.Signal) (<-chan struct{}, <-chan struct{}, func()) {
+	ch := make(chan os.Signal, 2)
+	signal.Notify(ch, sigs...)
+	drain, abort := make(chan struct{}), make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		for _, c := range []chan struct{}{drain, abort} {
+			select {
+			case <-ch:
+				close(c)
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return drain, abort, func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(done)
+		})
+	}
+}
+
+// RecoverItem ловит панику воркера стадии, обрабатывающего item:
+//	defer RecoverItem(out, item)
+// Внутри Pipeline паника превращается в StageError, вне конвейера - пробрасывается дальше
+func RecoverItem(out chan interface{}, item interface{}) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	st, ok := stageByOut.Load(out)
+	if !ok {
+		panic(r)
+	}
+	st.(*stageState).p.report(&StageError{
+		Stage: st.(*stageState).index,
+		Item:  item,
+		Panic: r,
+		Stack: debug.Stack(),
+	})
+}
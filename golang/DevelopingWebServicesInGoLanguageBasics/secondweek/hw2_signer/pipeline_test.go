@@ -0,0 +1,207 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func collectInts(got *[]int) job {
+	return func(in, out chan interface{}) {
+		for v := range in {
+			*got = append(*got, v.(int))
+		}
+	}
+}
+
+func panicOn(bad int) job {
+	return mapInts(func(v int) int {
+		if v == bad {
+			panic("bad item")
+		}
+		return v
+	})
+}
+
+func TestPipelineStagePanicFailFast(t *testing.T) {
+	var got []int
+	err := (&Pipeline{Jobs: []job{sourceOf(1, 2, 3), panicOn(2), collectInts(&got)}}).Run()
+
+	errs, ok := err.(StageErrors)
+	if !ok || len(errs) != 1 {
+		t.Fatalf("expected one stage error, got %v", err)
+	}
+	if errs[0].Stage != 1 || errs[0].Item != 2 || errs[0].Panic != "bad item" {
+		t.Errorf("unexpected error: %v", errs[0])
+	}
+	if !strings.Contains(string(errs[0].Stack), "panicOn") {
+		t.Errorf("stack trace missing panic location:\n%s", errs[0].Stack)
+	}
+	// 1 могла успеть дойти до конца, а 3 уже не должна была
+	if len(got) > 1 {
+		t.Errorf("unexpected items after fail-fast: %v", got)
+	}
+}
+
+func TestPipelineStagePanicSkipItem(t *testing.T) {
+	var got []int
+	err := (&Pipeline{
+		Jobs: []job{sourceOf(1, 2, 3, 2, 4), panicOn(2), collectInts(&got)},
+		Mode: SkipItem,
+	}).Run()
+
+	errs, ok := err.(StageErrors)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("expected two stage errors, got %v", err)
+	}
+	if !reflect.DeepEqual(got, []int{1, 3, 4}) {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", got, []int{1, 3, 4})
+	}
+}
+
+func TestPipelineStatefulStageSkipItem(t *testing.T) {
+	combine, err := CombineResultsWindowed(Window{Size: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []interface{}
+	ordered := OrderedMap(2, 2, func(item interface{}) interface{} {
+		if item == "x" {
+			panic("bad item")
+		}
+		return item
+	})
+	err = (&Pipeline{
+		Jobs: []job{
+			sendHashes("c", "x", "b", "d", "a"),
+			ordered,
+			job(func(in, out chan interface{}) {
+				for v := range in {
+					out <- v
+					if v == "c" {
+						out <- 42
+					}
+				}
+			}),
+			combine,
+			job(func(in, out chan interface{}) {
+				for v := range in {
+					got = append(got, v)
+				}
+			}),
+		},
+		Mode: SkipItem,
+	}).Run()
+
+	// окно и нумерация OrderedMap переживают пропущенные элементы
+	errs, ok := err.(StageErrors)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("expected two stage errors, got %v", err)
+	}
+	if expected := []interface{}{"b_c", "a_d"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", got, expected)
+	}
+}
+
+func TestPipelineStagePanicOnStart(t *testing.T) {
+	err := (&Pipeline{
+		Jobs: []job{
+			sourceOf(1, 2, 3),
+			job(func(in, out chan interface{}) { panic("broken stage") }),
+			collectInts(new([]int)),
+		},
+		Mode: SkipItem,
+	}).Run()
+
+	errs, ok := err.(StageErrors)
+	if !ok || len(errs) != 1 || errs[0].Item != nil {
+		t.Errorf("expected single error without item, got %v", err)
+	}
+}
+
+func TestPipelineWorkerPanic(t *testing.T) {
+	withFastSigners(t)
+	s := NewSigner()
+
+	var got []string
+	err := (&Pipeline{
+		Jobs: []job{
+			job(func(in, out chan interface{}) {
+				out <- "a"
+				out <- 42
+				out <- "b"
+			}),
+			s.MultiHash,
+			job(func(in, out chan interface{}) {
+				for v := range in {
+					got = append(got, v.(string))
+				}
+			}),
+		},
+		Mode: SkipItem,
+	}).Run()
+
+	errs, ok := err.(StageErrors)
+	if !ok || len(errs) != 1 || errs[0].Stage != 1 || errs[0].Item != 42 {
+		t.Fatalf("expected worker error for item 42, got %v", err)
+	}
+	sort.Strings(got)
+	expected := []string{s.MultiHashOf("a"), s.MultiHashOf("b")}
+	sort.Strings(expected)
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", got, expected)
+	}
+}
+
+func TestPipelineSignerPanic(t *testing.T) {
+	withFastSigners(t)
+	s := NewSigner()
+	expected := []string{s.SingleHashOf("1"), s.SingleHashOf("3")}
+	sort.Strings(expected)
+
+	// crc32 считается в горутинах рецепта, а не в самом воркере SingleHash
+	crc32 := DataSignerCrc32
+	DataSignerCrc32 = func(data string) string {
+		if data == "2" {
+			panic("crc32 failed")
+		}
+		return crc32(data)
+	}
+
+	var got []string
+	err := (&Pipeline{
+		Jobs: []job{
+			job(func(in, out chan interface{}) {
+				out <- 1
+				out <- 2
+				out <- 3
+			}),
+			s.SingleHash,
+			job(func(in, out chan interface{}) {
+				for v := range in {
+					got = append(got, v.(string))
+				}
+			}),
+		},
+		Mode: SkipItem,
+	}).Run()
+
+	errs, ok := err.(StageErrors)
+	if !ok || len(errs) != 1 || errs[0].Stage != 1 || errs[0].Item != 2 || errs[0].Panic != "crc32 failed" {
+		t.Fatalf("expected worker error for item 2, got %v", err)
+	}
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", got, expected)
+	}
+}
+
+func TestExecutePipelinePanics(t *testing.T) {
+	defer func() {
+		if _, ok := recover().(StageErrors); !ok {
+			t.Errorf("expected ExecutePipeline to panic with StageErrors")
+		}
+	}()
+	ExecutePipeline(sourceOf(1), panicOn(1), collectInts(new([]int)))
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var ErrItemTimeout = errors.New("item processing timed out")
+
+// ItemFunc обрабатывает один элемент стадии; ctx отменяется по истечении Timeout
+type ItemFunc func(ctx context.Context, item interface{}) (interface{}, error)
+
+// DeadLetter - элемент, для которого кончились попытки
+type DeadLetter struct {
+	Item     interface{}
+	Err      error
+	Attempts int
+}
+
+// ItemPolicy задает, как обрабатывать элемент: сколько ждать одну попытку,
+// сколько раз повторять и куда девать элемент, если ничего не вышло
+type ItemPolicy struct {
+	// Timeout ограничивает одну попытку; 0 - без ограничения
+	Timeout time.Duration
+	// Retries - сколько раз повторить после первой неудачной попытки
+	Retries int
+	// Backoff - пауза перед первым повтором, дальше удваивается до MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Jitter - доля паузы (0..1), на которую она случайно уменьшается
+	Jitter float64
+	// DeadLetter получает элементы, для которых кончились попытки; nil - такие элементы отбрасываются
+	DeadLetter chan<- DeadLetter
+}
+
+// Do обрабатывает элемент по правилам политики. Паника в f считается ошибкой попытки
+func (p ItemPolicy) Do(item interface{}, f ItemFunc) (interface{}, int, error) {
+	return p.DoContext(context.Background(), item, f)
+}
+
+// DoContext - Do, который после отмены ctx не начинает новых попыток и не ждет паузы между ними.
+// Паузы отсчитываются по SignerClock
+func (p ItemPolicy) DoContext(ctx context.Context, item interface{}, f ItemFunc) (interface{}, int, error) {
+	var (
+		res   interface{}
+		err   error
+		delay = p.Backoff
+	)
+	for attempt := 1; ; attempt++ {
+		res, err = p.attempt(ctx, item, f)
+		if err == nil || attempt > p.Retries {
+			return res, attempt, err
+		}
+		select {
+		case <-SignerClock.After(p.jitter(delay)):
+		case <-ctx.Done():
+			return nil, attempt, ctx.Err()
+		}
+		delay *= 2
+		if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+			delay = p.MaxBackoff
+		}
+	}
+}
+
+func (p ItemPolicy) attempt(ctx context.Context, item interface{}, f ItemFunc) (interface{}, error) {
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+
+	type result struct {
+		value interface{}
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- result{err: fmt.Errorf("panic: %v", r)}
+			}
+		}()
+		value, err := f(ctx, item)
+		done <- result{value: value, err: err}
+	}()
+
+	// f, не следящая за ctx, продолжит работать в фоне, но ее результат уже не нужен
+	select {
+	case r := <-done:
+		return r.value, r.err
+	case <-ctx.Done():
+		return nil, ErrItemTimeout
+	}
+}
+
+var (
+	jitterMu  sync.Mutex
+	jitterRnd = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+func (p ItemPolicy) jitter(d time.Duration) time.Duration {
+	if p.Jitter <= 0 || d <= 0 {
+		return d
+	}
+	jitterMu.Lock()
+	k := jitterRnd.Float64()
+	jitterMu.Unlock()
+	return d - time.Duration(float64(d)*p.Jitter*k)
+}
+
+// PolicyMap обрабатывает элементы in в workers горутинах по правилам политики.
+// Успешные результаты идут в out, неудачные элементы - в p.DeadLetter
+func PolicyMap(p ItemPolicy, workers int, f ItemFunc) job {
+	if workers < 1 {
+		workers = 1
+	}
+	return func(in, out chan interface{}) {
+		// остановка конвейера прерывает паузы между попытками
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			select {
+			case <-Stopping(out):
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		wg := &sync.WaitGroup{}
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				for item := range in {
+					res, attempts, err := p.DoContext(ctx, item, f)
+					if err == nil {
+						out <- res
+						continue
+					}
+					if p.DeadLetter != nil {
+						p.DeadLetter <- DeadLetter{Item: item, Err: err, Attempts: attempts}
+					}
+				}
+				wg.Done()
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+// SingleHashWithPolicy - SingleHash с таймаутами и повторами вызовов подписи.
+// После таймаута попытка не начинает новых вызовов подписи
+func (s *Signer) SingleHashWithPolicy(p ItemPolicy, workers int) job {
+	return PolicyMap(p, workers, func(ctx context.Context, rawData interface{}) (interface{}, error) {
+		return s.SingleHashContext(ctx, fmt.Sprint(rawData))
+	})
+}
+
+// MultiHashWithPolicy - MultiHash с таймаутами и повторами вызовов подписи
+func (s *Signer) MultiHashWithPolicy(p ItemPolicy, workers int) job {
+	return PolicyMap(p, workers, func(ctx context.Context, rawData interface{}) (interface{}, error) {
+		return s.MultiHashContext(ctx, rawData.(string))
+	})
+}
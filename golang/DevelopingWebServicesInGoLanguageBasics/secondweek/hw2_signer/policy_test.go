@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakySigner падает первые failures раз для каждого входа
+func flakySigner(failures int) (func(string) string, func(string) int) {
+	mu := &sync.Mutex{}
+	calls := map[string]int{}
+	f := func(data string) string {
+		mu.Lock()
+		calls[data]++
+		n := calls[data]
+		mu.Unlock()
+		if n <= failures {
+			panic("signer failed for " + data)
+		}
+		return "crc(" + data + ")"
+	}
+	count := func(data string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls[data]
+	}
+	return f, count
+}
+
+func TestPolicyRetry(t *testing.T) {
+	withFastSigners(t)
+	crc, calls := flakySigner(2)
+	DataSignerCrc32 = crc
+
+	p := ItemPolicy{Retries: 2, Backoff: time.Millisecond, Jitter: 0.5}
+	res, attempts, err := p.Do("x", func(ctx context.Context, item interface{}) (interface{}, error) {
+		return DataSignerCrc32(item.(string)), nil
+	})
+	if err != nil || res != "crc(x)" || attempts != 3 || calls("x") != 3 {
+		t.Errorf("unexpected result: %v, attempts %d, err %v", res, attempts, err)
+	}
+}
+
+func TestPolicyBackoffClock(t *testing.T) {
+	clock := withFakeClock(t)
+	withFastSigners(t)
+	crc, _ := flakySigner(2)
+	DataSignerCrc32 = crc
+
+	// паузы 1h и 2h идут по SignerClock, а не по настоящему времени
+	p := ItemPolicy{Retries: 2, Backoff: time.Hour}
+	start, realStart := clock.Now(), time.Now()
+	res, attempts, err := p.Do("x", func(ctx context.Context, item interface{}) (interface{}, error) {
+		return DataSignerCrc32(item.(string)), nil
+	})
+	if err != nil || res != "crc(x)" || attempts != 3 {
+		t.Errorf("unexpected result: %v, attempts %d, err %v", res, attempts, err)
+	}
+	if elapsed := clock.Since(start); elapsed < 3*time.Hour {
+		t.Errorf("backoff not waited on clock: %s", elapsed)
+	}
+	if realElapsed := time.Since(realStart); realElapsed > time.Second {
+		t.Errorf("backoff took real time: %s", realElapsed)
+	}
+}
+
+func TestPolicyBackoffContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	fail := errors.New("bad item")
+
+	p := ItemPolicy{Retries: 5, Backoff: time.Hour}
+	start := time.Now()
+	_, attempts, err := p.DoContext(ctx, "x", func(ctx context.Context, item interface{}) (interface{}, error) {
+		return nil, fail
+	})
+	if err != context.DeadlineExceeded || attempts != 1 {
+		t.Errorf("unexpected result: attempts %d, err %v", attempts, err)
+	}
+	if end := time.Since(start); end > time.Second {
+		t.Errorf("backoff ignored ctx: %s", end)
+	}
+}
+
+func TestPolicyDeadLetter(t *testing.T) {
+	withFastSigners(t)
+	crc, _ := flakySigner(1)
+	DataSignerCrc32 = crc
+
+	deadLetters := make(chan DeadLetter, 10)
+	p := ItemPolicy{Retries: 1, Backoff: time.Millisecond, DeadLetter: deadLetters}
+	fail := errors.New("bad item")
+
+	var got []interface{}
+	ExecutePipeline(
+		sourceOf(1, 2, 3),
+		PolicyMap(p, 2, func(ctx context.Context, item interface{}) (interface{}, error) {
+			if item.(int) == 2 {
+				return nil, fail
+			}
+			return DataSignerCrc32("a"), nil
+		}),
+		job(func(in, out chan interface{}) {
+			for v := range in {
+				got = append(got, v)
+			}
+		}),
+	)
+	close(deadLetters)
+
+	if len(got) != 2 {
+		t.Errorf("expected 2 successful items, got %v", got)
+	}
+	var dead []DeadLetter
+	for d := range deadLetters {
+		dead = append(dead, d)
+	}
+	if len(dead) != 1 || dead[0].Item != 2 || dead[0].Err != fail || dead[0].Attempts != 2 {
+		t.Errorf("unexpected dead letters: %+v", dead)
+	}
+}
+
+func TestPolicyTimeout(t *testing.T) {
+	withFastSigners(t)
+	release := make(chan struct{})
+	// брошенные попытки читают DataSigner*, поэтому до их восстановления
+	// в Cleanup надо дождаться всех начатых вызовов
+	var started uint32
+	finished := make(chan struct{}, 10)
+	defer func() {
+		close(release)
+		for n := atomic.LoadUint32(&started); n > 0; n-- {
+			<-finished
+		}
+	}()
+	crc32 := DataSignerCrc32
+	DataSignerCrc32 = func(data string) string {
+		atomic.AddUint32(&started, 1)
+		defer func() { finished <- struct{}{} }()
+		return crc32(data)
+	}
+	DataSignerMd5 = func(data string) string {
+		atomic.AddUint32(&started, 1)
+		defer func() { finished <- struct{}{} }()
+		<-release
+		return data
+	}
+
+	deadLetters := make(chan DeadLetter, 10)
+	p := ItemPolicy{Timeout: 20 * time.Millisecond, Retries: 1, DeadLetter: deadLetters}
+
+	start := time.Now()
+	ExecutePipeline(
+		sourceOf(1),
+		NewSigner().SingleHashWithPolicy(p, 1),
+		job(func(in, out chan interface{}) {
+			for v := range in {
+				t.Errorf("unexpected result %v", v)
+			}
+		}),
+	)
+	close(deadLetters)
+
+	if end := time.Since(start); end > time.Second {
+		t.Errorf("hung signer not abandoned: %s", end)
+	}
+	d := <-deadLetters
+	if d.Err != ErrItemTimeout || d.Attempts != 2 {
+		t.Errorf("unexpected dead letter: %+v", d)
+	}
+}
+
+func TestPolicyMapTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	hungSigner := func(ctx context.Context, item interface{}) (interface{}, error) {
+		<-release
+		return item, nil
+	}
+
+	deadLetters := make(chan DeadLetter, 10)
+	p := ItemPolicy{Timeout: 20 * time.Millisecond, Retries: 1, DeadLetter: deadLetters}
+
+	start := time.Now()
+	ExecutePipeline(
+		sourceOf(1),
+		PolicyMap(p, 1, hungSigner),
+		job(func(in, out chan interface{}) {
+			for v := range in {
+				t.Errorf("unexpected result %v", v)
+			}
+		}),
+	)
+	close(deadLetters)
+
+	if end := time.Since(start); end > time.Second {
+		t.Errorf("hung signer not abandoned: %s", end)
+	}
+	d := <-deadLetters
+	if d.Err != ErrItemTimeout || d.Attempts != 2 {
+		t.Errorf("unexpected dead letter: %+v", d)
+	}
+}
+
+func TestPolicySignerPanic(t *testing.T) {
+	withFastSigners(t)
+	s := NewSigner()
+	expected := s.SingleHashOf("1")
+	crc32 := DataSignerCrc32
+	DataSignerCrc32 = func(data string) string {
+		if data == "2" {
+			panic("crc32 failed")
+		}
+		return crc32(data)
+	}
+
+	deadLetters := make(chan DeadLetter, 10)
+	p := ItemPolicy{Retries: 1, DeadLetter: deadLetters}
+	var got []interface{}
+	ExecutePipeline(
+		sourceOf(1, 2),
+		s.SingleHashWithPolicy(p, 2),
+		job(func(in, out chan interface{}) {
+			for v := range in {
+				got = append(got, v)
+			}
+		}),
+	)
+	close(deadLetters)
+
+	if len(got) != 1 || got[0] != expected {
+		t.Errorf("results not match\nGot: %v\nExpected: [%v]", got, expected)
+	}
+	d := <-deadLetters
+	if d.Item != 2 || d.Err == nil || d.Err.Error() != "panic: crc32 failed" || d.Attempts != 2 {
+		t.Errorf("unexpected dead letter: %+v", d)
+	}
+}
+
+func TestPolicyTimeoutStopsSigner(t *testing.T) {
+	calls := withFastSigners(t)
+	release, md5Done := make(chan struct{}), make(chan struct{})
+	DataSignerMd5 = func(data string) string {
+		<-release
+		close(md5Done)
+		return data
+	}
+
+	p := ItemPolicy{Timeout: 20 * time.Millisecond}
+	_, _, err := p.Do("1", func(ctx context.Context, item interface{}) (interface{}, error) {
+		return NewSigner().SingleHashContext(ctx, item.(string))
+	})
+	if err != ErrItemTimeout {
+		t.Fatalf("expected timeout, got %v", err)
+	}
+
+	// брошенная попытка дожидается md5, но crc32(md5(data)) уже не считает
+	close(release)
+	<-md5Done
+	time.Sleep(20 * time.Millisecond)
+	if n := atomic.LoadUint32(&calls.crc32); n != 1 {
+		t.Errorf("signer kept working after timeout\nGot: %d crc32 calls\nExpected: 1", n)
+	}
+}
+
+func TestPolicyTimeoutReleasesLimiter(t *testing.T) {
+	withFastSigners(t)
+	s := NewSigner()
+	// md5 занят другим вызовом, попытка ждет в очереди Md5Limiter и должна из нее уйти
+	s.Md5Limiter.Acquire()
+	defer s.Md5Limiter.Release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := s.SingleHashContext(ctx, "1"); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline error, got %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"container/heap"
+	"time"
+)
+
+// Prioritized - элемент, который сам знает свой приоритет (см. ItemPriority)
+type Prioritized interface {
+	Priority() int
+}
+
+// ItemPriority - Pipeline.Priority для элементов, реализующих Prioritized; остальные получают 0
+func ItemPriority(item interface{}) int {
+	if p, ok := item.(Prioritized); ok {
+		return p.Priority()
+	}
+	return 0
+}
+
+type queuedItem struct {
+	item     interface{}
+	priority int
+	// at - когда элемент встал в очередь, от создания очереди
+	at  time.Duration
+	seq int64
+}
+
+// stageQueue - очередь перед стадией: сначала выдает элементы с большим приоритетом,
+// при равных - по порядку поступления. С aging > 0 каждые aging ожидания прибавляют
+// элементу единицу приоритета, так что срочные элементы не задерживают остальные вечно
+type stageQueue struct {
+	items    []*queuedItem
+	size     int
+	priority func(interface{}) int
+	aging    time.Duration
+	start    time.Time
+	seq      int64
+}
+
+// newStageQueue без priority - обычная FIFO очередь на size элементов
+func newStageQueue(size int, priority func(interface{}) int, aging time.Duration) *stageQueue {
+	if size < 1 {
+		size = 1
+	}
+	return &stageQueue{size: size, priority: priority, aging: aging, start: time.Now()}
+}
+
+func (q *stageQueue) Len() int { return len(q.items) }
+
+func (q *stageQueue) Less(i, j int) bool {
+	a, b := q.items[i], q.items[j]
+	if a.priority != b.priority || q.aging > 0 {
+		// приоритет на данный момент - priority + ждал/aging; время ожидания у всех растет
+		// одинаково, поэтому сравнивать можно по моменту постановки в очередь
+		ka, kb := float64(a.priority), float64(b.priority)
+		if q.aging > 0 {
+			ka -= float64(a.at) / float64(q.aging)
+			kb -= float64(b.at) / float64(q.aging)
+		}
+		if ka != kb {
+			return ka > kb
+		}
+	}
+	return a.seq < b.seq
+}
+
+func (q *stageQueue) Swap(i, j int) { q.items[i], q.items[j] = q.items[j], q.items[i] }
+
+func (q *stageQueue) Push(x interface{}) { q.items = append(q.items, x.(*queuedItem)) }
+
+func (q *stageQueue) Pop() interface{} {
+	last := q.items[len(q.items)-1]
+	q.items[len(q.items)-1] = nil
+	q.items = q.items[:len(q.items)-1]
+	return last
+}
+
+func (q *stageQueue) full() bool {
+	return len(q.items) >= q.size
+}
+
+func (q *stageQueue) put(item interface{}) {
+	qi := &queuedItem{item: item, seq: q.seq}
+	q.seq++
+	if q.priority != nil {
+		qi.priority = q.priority(item)
+		qi.at = time.Since(q.start)
+	}
+	heap.Push(q, qi)
+}
+
+// peek - элемент, который очередь выдаст следующим
+func (q *stageQueue) peek() interface{} {
+	return q.items[0].item
+}
+
+func (q *stageQueue) take() interface{} {
+	return heap.Pop(q).(*queuedItem).item
+}
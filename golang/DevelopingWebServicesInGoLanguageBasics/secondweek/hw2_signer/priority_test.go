@@ -0,0 +1,108 @@
+package main
+
+import (
+	"container/heap"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type task struct {
+	id     int
+	urgent bool
+}
+
+func (t task) Priority() int {
+	if t.urgent {
+		return 10
+	}
+	return 0
+}
+
+func TestStageQueueOrder(t *testing.T) {
+	q := newStageQueue(10, func(item interface{}) int { return item.(int) / 10 }, 0)
+	for _, v := range []int{1, 52, 30, 51, 2} {
+		q.put(v)
+	}
+	var got []int
+	for q.Len() > 0 {
+		got = append(got, q.take().(int))
+	}
+	if expected := []int{52, 51, 30, 1, 2}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", got, expected)
+	}
+}
+
+func TestStageQueueAging(t *testing.T) {
+	q := newStageQueue(10, ItemPriority, time.Millisecond)
+	// обычный элемент ждет на 12мс дольше срочного (+10) и обгоняет его,
+	// а обычный, который ждет всего на 7мс дольше, - нет
+	heap.Push(q, &queuedItem{item: "bulk", priority: 0, at: 0, seq: 0})
+	heap.Push(q, &queuedItem{item: "urgent", priority: 10, at: 12 * time.Millisecond, seq: 1})
+	heap.Push(q, &queuedItem{item: "newer bulk", priority: 0, at: 5 * time.Millisecond, seq: 2})
+
+	var got []string
+	for q.Len() > 0 {
+		got = append(got, q.take().(string))
+	}
+	if expected := []string{"bulk", "urgent", "newer bulk"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", got, expected)
+	}
+}
+
+func TestPipelinePriority(t *testing.T) {
+	var got []task
+	err := (&Pipeline{
+		Jobs: []job{
+			job(func(in, out chan interface{}) {
+				for i := 0; i < 50; i++ {
+					out <- task{id: i}
+				}
+				for i := 50; i < 55; i++ {
+					out <- task{id: i, urgent: true}
+				}
+			}),
+			job(func(in, out chan interface{}) {
+				out <- <-in
+				// пока стадия занята, очередь успевает набрать все элементы
+				time.Sleep(20 * time.Millisecond)
+				for v := range in {
+					out <- v
+				}
+			}),
+			job(func(in, out chan interface{}) {
+				for v := range in {
+					got = append(got, v.(task))
+				}
+			}),
+		},
+		Priority: ItemPriority,
+	}).Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 55 {
+		t.Fatalf("expected 55 items, got %d", len(got))
+	}
+	// до того, как очередь набралась, стадия могла взять максимум один обычный элемент
+	urgent := 0
+	for _, item := range got[:6] {
+		if item.urgent {
+			urgent++
+		}
+	}
+	if urgent != 5 {
+		t.Fatalf("urgent items waited behind bulk ones: %v", got[:10])
+	}
+	// обычные элементы сохранили порядок между собой
+	prev := -1
+	for _, item := range got {
+		if !item.urgent {
+			if item.id < prev {
+				t.Fatalf("bulk items reordered: %v", got)
+			}
+			prev = item.id
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type HashFunc func(data string) string
+
+// HashFuncs - хеш-функции, доступные в рецептах помимо crc32 и md5.
+// crc32 и md5 всегда вызывают DataSignerCrc32 и DataSignerMd5
+var HashFuncs = map[string]HashFunc{
+	"sha1": func(data string) string {
+		return fmt.Sprintf("%x", sha1.Sum([]byte(data+DataSignerSalt)))
+	},
+	"sha256": func(data string) string {
+		return fmt.Sprintf("%x", sha256.Sum256([]byte(data+DataSignerSalt)))
+	},
+	"fnv": func(data string) string {
+		h := fnv.New32a()
+		h.Write([]byte(data + DataSignerSalt))
+		return strconv.FormatUint(uint64(h.Sum32()), 10)
+	},
+}
+
+const (
+	SingleHashRecipe = `crc32(data) + "~" + crc32(md5(data))`
+	MultiHashRecipe  = `crc32("0" + data) + crc32("1" + data) + crc32("2" + data) + ` +
+		`crc32("3" + data) + crc32("4" + data) + crc32("5" + data)`
+)
+
+// Recipe - выражение из хеш-функций над входными данными, например
+//	crc32(data) + "~" + crc32(md5(data))
+// data - входное значение, salt - соль подписывающего (DataSignerSalt), "..." - строка, + - конкатенация
+type Recipe struct {
+	src  string
+	root recipeNode
+}
+
+type recipeNode interface {
+	eval(data string, env *recipeEnv) string
+	slow() bool
+	// canonical - запись узла без лишних пробелов
+	canonical() string
+}
+
+// recipeEnv - чем считается рецепт: хеш-функции по имени и значение salt
+type recipeEnv struct {
+	hash func(name string) HashFunc
+	salt string
+}
+
+type recipeData struct{}
+
+type recipeSalt struct{}
+
+type recipeString string
+
+type recipeCall struct {
+	name string
+	arg  recipeNode
+}
+
+type recipeConcat []recipeNode
+
+func (recipeData) eval(data string, _ *recipeEnv) string { return data }
+func (recipeData) slow() bool                            { return false }
+func (recipeData) canonical() string                     { return "data" }
+
+func (recipeSalt) eval(_ string, env *recipeEnv) string { return env.salt }
+func (recipeSalt) slow() bool                           { return false }
+func (recipeSalt) canonical() string                    { return "salt" }
+
+func (n recipeString) eval(string, *recipeEnv) string { return string(n) }
+func (n recipeString) slow() bool                     { return false }
+func (n recipeString) canonical() string              { return strconv.Quote(string(n)) }
+
+func (n recipeCall) eval(data string, env *recipeEnv) string {
+	return env.hash(n.name)(n.arg.eval(data, env))
+}
+func (n recipeCall) slow() bool { return true }
+func (n recipeCall) canonical() string {
+	return n.name + "(" + n.arg.canonical() + ")"
+}
+
+// части конкатенации с вызовами хеш-функций считаются параллельно.
+// Паника в части повторяется в вызывающей горутине, где ее может поймать RecoverItem
+func (n recipeConcat) eval(data string, env *recipeEnv) string {
+	parts := make([]string, len(n))
+	panics := make([]interface{}, len(n))
+	wg := &sync.WaitGroup{}
+	for i, part := range n {
+		if !part.slow() {
+			parts[i] = part.eval(data, env)
+			continue
+		}
+		wg.Add(1)
+		go func(i int, part recipeNode) {
+			defer func() {
+				if r := recover(); r != nil {
+					panics[i] = r
+				}
+				wg.Done()
+			}()
+			parts[i] = part.eval(data, env)
+		}(i, part)
+	}
+	wg.Wait()
+	for _, r := range panics {
+		if r != nil {
+			panic(r)
+		}
+	}
+	return strings.Join(parts, "")
+}
+func (n recipeConcat) canonical() string {
+	parts := make([]string, len(n))
+	for i, part := range n {
+		parts[i] = part.canonical()
+	}
+	return strings.Join(parts, " + ")
+}
+func (n recipeConcat) slow() bool {
+	for _, part := range n {
+		if part.slow() {
+			return true
+		}
+	}
+	return false
+}
+
+func ParseRecipe(src string) (*Recipe, error) {
+	p := &recipeParser{src: src}
+	root, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if p.skipSpaces(); p.pos < len(p.src) {
+		return nil, p.errorf("unexpected %q", p.src[p.pos])
+	}
+	return &Recipe{src: src, root: root}, nil
+}
+
+func MustParseRecipe(src string) *Recipe {
+	r, err := ParseRecipe(src)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+func (r *Recipe) String() string {
+	return r.src
+}
+
+// Canonical - запись рецепта, одинаковая для рецептов, которые отличаются только пробелами и экранированием строк
+func (r *Recipe) Canonical() string {
+	return r.root.canonical()
+}
+
+// Eval считает рецепт, беря crc32 и md5 из DataSignerCrc32 и DataSignerMd5
+func (r *Recipe) Eval(data string) string {
+	return r.EvalWith(data, nil)
+}
+
+// EvalWith считает рецепт, подставляя функции из funcs вместо стандартных
+func (r *Recipe) EvalWith(data string, funcs map[string]HashFunc) string {
+	return r.root.eval(data, &recipeEnv{hash: lookupIn(funcs), salt: DataSignerSalt})
+}
+
+// recipeAbort - паника, которой хеш-функции EvalContext прерывают вычисление после отмены ctx
+type recipeAbort struct {
+	err error
+}
+
+// EvalContext - EvalWith, который после отмены ctx не начинает новых вызовов хеш-функций
+// и возвращает ctx.Err(). Уже начатые вызовы не прерываются, но их результат отбрасывается
+func (r *Recipe) EvalContext(ctx context.Context, data string, funcs map[string]HashFunc) (string, error) {
+	return r.evalContext(ctx, data, &recipeEnv{hash: lookupIn(funcs), salt: DataSignerSalt})
+}
+
+func (r *Recipe) evalContext(ctx context.Context, data string, env *recipeEnv) (res string, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			abort, ok := p.(recipeAbort)
+			if !ok {
+				panic(p)
+			}
+			err = abort.err
+		}
+	}()
+	return r.root.eval(data, &recipeEnv{
+		salt: env.salt,
+		hash: func(name string) HashFunc {
+			f := env.hash(name)
+			return func(data string) string {
+				if err := ctx.Err(); err != nil {
+					panic(recipeAbort{err})
+				}
+				return f(data)
+			}
+		},
+	}), nil
+}
+
+// lookupIn ищет функцию сначала в funcs, потом среди стандартных
+func lookupIn(funcs map[string]HashFunc) func(string) HashFunc {
+	return func(name string) HashFunc {
+		if f, ok := funcs[name]; ok {
+			return f
+		}
+		return lookupHash(name)
+	}
+}
+
+func lookupHash(name string) HashFunc {
+	switch name {
+	case "crc32":
+		return func(data string) string { return DataSignerCrc32(data) }
+	case "md5":
+		return func(data string) string { return DataSignerMd5(data) }
+	}
+	return HashFuncs[name]
+}
+
+type recipeParser struct {
+	src string
+	pos int
+}
+
+func (p *recipeParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("recipe %q: pos %d: %s", p.src, p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *recipeParser) skipSpaces() {
+	for p.pos < len(p.src) && strings.IndexByte(" \t\n\r", p.src[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+func (p *recipeParser) peek() byte {
+	p.skipSpaces()
+	if p.pos >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+// expr := term { "+" term }
+func (p *recipeParser) expr() (recipeNode, error) {
+	var parts recipeConcat
+	for {
+		term, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, term)
+		if p.peek() != '+' {
+			break
+		}
+		p.pos++
+	}
+	if len(parts) == 1 {
+		return parts[0], nil
+	}
+	return parts, nil
+}
+
+// term := string | "data" | "salt" | name "(" expr ")"
+func (p *recipeParser) term() (recipeNode, error) {
+	switch c := p.peek(); {
+	case c == '"':
+		end := p.pos + 1
+		for end < len(p.src) && p.src[end] != '"' {
+			if p.src[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(p.src) {
+			return nil, p.errorf("unterminated string")
+		}
+		str, err := strconv.Unquote(p.src[p.pos : end+1])
+		if err != nil {
+			return nil, p.errorf("bad string: %v", err)
+		}
+		p.pos = end + 1
+		return recipeString(str), nil
+	case isIdentByte(c):
+		start := p.pos
+		for p.pos < len(p.src) && isIdentByte(p.src[p.pos]) {
+			p.pos++
+		}
+		name := p.src[start:p.pos]
+		if p.peek() != '(' {
+			switch name {
+			case "data":
+				return recipeData{}, nil
+			case "salt":
+				return recipeSalt{}, nil
+			}
+			p.pos = start
+			return nil, p.errorf("unknown variable %q", name)
+		}
+		if lookupHash(name) == nil {
+			p.pos = start
+			return nil, p.errorf("unknown hash function %q", name)
+		}
+		p.pos++
+		arg, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, p.errorf("expected ')'")
+		}
+		p.pos++
+		return recipeCall{name: name, arg: arg}, nil
+	case c == 0:
+		return nil, p.errorf("unexpected end")
+	default:
+		return nil, p.errorf("unexpected %q", c)
+	}
+}
+
+func isIdentByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_'
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"testing"
+)
+
+func TestRecipeDefaults(t *testing.T) {
+	withFastSigners(t)
+
+	data := "42"
+	expectedSingle := DataSignerCrc32(data) + "~" + DataSignerCrc32(DataSignerMd5(data))
+	if res := MustParseRecipe(SingleHashRecipe).Eval(data); res != expectedSingle {
+		t.Errorf("single hash recipe not match\nGot: %v\nExpected: %v", res, expectedSingle)
+	}
+
+	expectedMulti := ""
+	for th := 0; th < 6; th++ {
+		expectedMulti += DataSignerCrc32(fmt.Sprint(th) + expectedSingle)
+	}
+	if res := MustParseRecipe(MultiHashRecipe).Eval(expectedSingle); res != expectedMulti {
+		t.Errorf("multi hash recipe not match\nGot: %v\nExpected: %v", res, expectedMulti)
+	}
+}
+
+func TestRecipeCustom(t *testing.T) {
+	withFastSigners(t)
+	DataSignerSalt = "pepper"
+	defer func() { DataSignerSalt = "" }()
+
+	r := MustParseRecipe(`sha256(salt + data) + "-" + fnv("x")`)
+	expected := fmt.Sprintf("%x", sha256.Sum256([]byte("pepper1pepper"))) + "-" + HashFuncs["fnv"]("x")
+	if res := r.Eval("1"); res != expected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", res, expected)
+	}
+
+	s := NewSigner()
+	s.SingleRecipe = MustParseRecipe(`md5(data)`)
+	s.MultiRecipe = MustParseRecipe(`sha1(data)`)
+	expected = HashFuncs["sha1"](DataSignerMd5("7"))
+	if res := runSigner(s, 7); res != expected {
+		t.Errorf("signer recipes not used\nGot: %v\nExpected: %v", res, expected)
+	}
+}
+
+func TestRecipeParseErrors(t *testing.T) {
+	for _, src := range []string{
+		``,
+		`crc32(data`,
+		`whirlpool(data)`,
+		`crc32(data) +`,
+		`"unterminated`,
+		`input`,
+		`crc32(data) crc32(data)`,
+	} {
+		if _, err := ParseRecipe(src); err == nil {
+			t.Errorf("expected error for recipe %q", src)
+		}
+	}
+}
@@ -0,0 +1,435 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/rpc"
+	"sync"
+	"time"
+)
+
+// SignArgs и SignReply - сообщения протокола удаленных воркеров
+type SignArgs struct {
+	Data string
+	SignOptions
+}
+
+// SignOptions - настройки координатора, с которыми воркер должен считать подпись.
+// Нулевые SignOptions - считать с собственными настройками воркера
+type SignOptions struct {
+	Salt         string
+	SingleRecipe string
+	MultiRecipe  string
+	// Md5Concurrency, Md5Interval и Md5Burst - параметры Md5Limiter (см. NewLimiter)
+	Md5Concurrency int
+	Md5Interval    time.Duration
+	Md5Burst       int
+}
+
+// SignOptions - настройки s для удаленных воркеров
+func (s *Signer) SignOptions() SignOptions {
+	opts := SignOptions{
+		Salt:         s.Salt,
+		SingleRecipe: s.singleRecipe().String(),
+		MultiRecipe:  s.multiRecipe().String(),
+	}
+	if s.Md5Limiter != nil {
+		opts.Md5Concurrency, opts.Md5Interval, opts.Md5Burst = s.Md5Limiter.Settings()
+	}
+	return opts
+}
+
+type SignReply struct {
+	Hash string
+}
+
+// SignService - то, что воркер отдает по net/rpc под именем "Signer"
+type SignService struct {
+	s *Signer
+
+	mu      sync.Mutex
+	signers map[SignOptions]*Signer
+}
+
+func (svc *SignService) SingleHash(args SignArgs, reply *SignReply) error {
+	return svc.sign(args, reply, (*Signer).SingleHashOf)
+}
+
+func (svc *SignService) MultiHash(args SignArgs, reply *SignReply) error {
+	return svc.sign(args, reply, (*Signer).MultiHashOf)
+}
+
+func (svc *SignService) sign(args SignArgs, reply *SignReply, f func(*Signer, string) string) (err error) {
+	defer recoverCall(&err)
+	if args.SignOptions == (SignOptions{}) {
+		reply.Hash = f(svc.s, args.Data)
+		return nil
+	}
+	s, err := svc.signer(args.SignOptions)
+	if err != nil {
+		return err
+	}
+	reply.Hash = f(s, args.Data)
+	return nil
+}
+
+// signer - подписывающий с настройками координатора; кеши общие с собственным подписывающим воркера
+func (svc *SignService) signer(opts SignOptions) (*Signer, error) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	if s, ok := svc.signers[opts]; ok {
+		return s, nil
+	}
+	s := *svc.s
+	s.Salt = opts.Salt
+	s.Md5Limiter = NewLimiter(opts.Md5Concurrency, opts.Md5Interval, opts.Md5Burst)
+	var err error
+	if s.SingleRecipe, err = ParseRecipe(opts.SingleRecipe); err != nil {
+		return nil, err
+	}
+	if s.MultiRecipe, err = ParseRecipe(opts.MultiRecipe); err != nil {
+		return nil, err
+	}
+	if svc.signers == nil {
+		svc.signers = make(map[SignOptions]*Signer)
+	}
+	svc.signers[opts] = &s
+	return &s, nil
+}
+
+func (svc *SignService) Ping(args struct{}, reply *bool) error {
+	*reply = true
+	return nil
+}
+
+func recoverCall(err *error) {
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("signer panicked: %v", r)
+	}
+}
+
+// SignerServer - процесс-воркер, считающий SingleHash и MultiHash для координатора
+type SignerServer struct {
+	server *rpc.Server
+
+	mu        sync.Mutex
+	listeners []net.Listener
+	conns     map[net.Conn]struct{}
+	closed    bool
+	// wg считает горутины соединений, Close их дожидается
+	wg sync.WaitGroup
+}
+
+func NewSignerServer(s *Signer) *SignerServer {
+	server := rpc.NewServer()
+	server.RegisterName("Signer", &SignService{s: s})
+	return &SignerServer{
+		server: server,
+		conns:  make(map[net.Conn]struct{}),
+	}
+}
+
+// Serve принимает соединения, пока не закроется l или не будет вызван Close
+func (srv *SignerServer) Serve(l net.Listener) error {
+	srv.mu.Lock()
+	if srv.closed {
+		srv.mu.Unlock()
+		return errors.New("signer server closed")
+	}
+	srv.listeners = append(srv.listeners, l)
+	srv.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			srv.mu.Lock()
+			closed := srv.closed
+			srv.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		srv.mu.Lock()
+		if srv.closed {
+			srv.mu.Unlock()
+			conn.Close()
+			return nil
+		}
+		srv.conns[conn] = struct{}{}
+		srv.wg.Add(1)
+		srv.mu.Unlock()
+		go func() {
+			defer srv.wg.Done()
+			srv.server.ServeConn(conn)
+			srv.mu.Lock()
+			delete(srv.conns, conn)
+			srv.mu.Unlock()
+		}()
+	}
+}
+
+// Close останавливает прием соединений, рвет уже открытые и ждет, пока доработают
+// начатые на них вызовы
+func (srv *SignerServer) Close() error {
+	srv.mu.Lock()
+	srv.closed = true
+	for _, l := range srv.listeners {
+		l.Close()
+	}
+	for conn := range srv.conns {
+		conn.Close()
+	}
+	srv.mu.Unlock()
+	srv.wg.Wait()
+	return nil
+}
+
+var ErrNoWorkers = errors.New("no healthy signer workers")
+
+// WorkerPool - координатор: раздает элементы удаленным воркерам по кругу,
+// проверяет их здоровье и переотправляет элемент другому воркеру, если вызов не удался
+type WorkerPool struct {
+	// HealthInterval - как часто пинговать воркеры и пытаться вернуть упавшие
+	HealthInterval time.Duration
+	// CallTimeout ограничивает один удаленный вызов
+	CallTimeout time.Duration
+	// DispatchTimeout - сколько элемент может ждать здорового воркера
+	DispatchTimeout time.Duration
+	// Options отправляются воркерам с каждым элементом, см. Signer.SignOptions
+	Options SignOptions
+
+	mu      sync.Mutex
+	workers []*remoteWorker
+	next    int
+
+	stop chan struct{}
+	once sync.Once
+}
+
+type remoteWorker struct {
+	addr    string
+	client  *rpc.Client
+	healthy bool
+}
+
+func NewWorkerPool(addrs ...string) *WorkerPool {
+	p := &WorkerPool{
+		HealthInterval:  time.Second,
+		CallTimeout:     10 * time.Second,
+		DispatchTimeout: 30 * time.Second,
+		stop:            make(chan struct{}),
+	}
+	for _, addr := range addrs {
+		p.workers = append(p.workers, &remoteWorker{addr: addr})
+	}
+	return p
+}
+
+// Start подключается к воркерам и запускает проверки здоровья
+func (p *WorkerPool) Start() {
+	p.checkHealth()
+	go func() {
+		ticker := time.NewTicker(p.HealthInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.checkHealth()
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (p *WorkerPool) Close() {
+	p.once.Do(func() {
+		close(p.stop)
+	})
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, w := range p.workers {
+		if w.client != nil {
+			w.client.Close()
+			w.client = nil
+		}
+		w.healthy = false
+	}
+}
+
+// Healthy - сколько воркеров сейчас принимают элементы
+func (p *WorkerPool) Healthy() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := 0
+	for _, w := range p.workers {
+		if w.healthy {
+			n++
+		}
+	}
+	return n
+}
+
+func (p *WorkerPool) checkHealth() {
+	p.mu.Lock()
+	workers := make([]*remoteWorker, len(p.workers))
+	copy(workers, p.workers)
+	p.mu.Unlock()
+
+	wg := &sync.WaitGroup{}
+	for _, w := range workers {
+		wg.Add(1)
+		go func(w *remoteWorker) {
+			defer wg.Done()
+			p.mu.Lock()
+			client := w.client
+			p.mu.Unlock()
+
+			if client == nil {
+				conn, err := net.DialTimeout("tcp", w.addr, p.CallTimeout)
+				if err != nil {
+					p.markFailed(w, nil)
+					return
+				}
+				client = rpc.NewClient(conn)
+			}
+			var ok bool
+			if err := p.callClient(client, "Signer.Ping", struct{}{}, &ok); err != nil {
+				if _, timedOut := err.(callTimeoutError); timedOut {
+					// соединение живо, воркер просто не успел ответить
+					p.mu.Lock()
+					w.client, w.healthy = client, false
+					p.mu.Unlock()
+					return
+				}
+				p.markFailed(w, client)
+				return
+			}
+			p.mu.Lock()
+			w.client, w.healthy = client, true
+			p.mu.Unlock()
+		}(w)
+	}
+	wg.Wait()
+}
+
+// markFailed закрывает соединение после ошибки транспорта и выводит воркер из ротации
+func (p *WorkerPool) markFailed(w *remoteWorker, client *rpc.Client) {
+	if client != nil {
+		client.Close()
+	}
+	p.mu.Lock()
+	if w.client == client {
+		w.client, w.healthy = nil, false
+	}
+	p.mu.Unlock()
+}
+
+func (p *WorkerPool) callClient(client *rpc.Client, method string, args, reply interface{}) error {
+	call := client.Go(method, args, reply, make(chan *rpc.Call, 1))
+	timer := time.NewTimer(p.CallTimeout)
+	defer timer.Stop()
+	select {
+	case <-call.Done:
+		return call.Error
+	case <-timer.C:
+		return callTimeoutError{method: method, timeout: p.CallTimeout}
+	}
+}
+
+// callTimeoutError - вызов не уложился в CallTimeout. Ответ на него потом просто отбросится,
+// соединение остается рабочим для остальных вызовов
+type callTimeoutError struct {
+	method  string
+	timeout time.Duration
+}
+
+func (e callTimeoutError) Error() string {
+	return fmt.Sprintf("%s: timed out after %s", e.method, e.timeout)
+}
+
+func (p *WorkerPool) pick() (*remoteWorker, *rpc.Client) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := 0; i < len(p.workers); i++ {
+		w := p.workers[(p.next+i)%len(p.workers)]
+		if w.healthy {
+			p.next = (p.next + i + 1) % len(p.workers)
+			return w, w.client
+		}
+	}
+	return nil, nil
+}
+
+func (p *WorkerPool) call(method, data string) (string, error) {
+	deadline := time.Now().Add(p.DispatchTimeout)
+	var lastErr error = ErrNoWorkers
+	for time.Now().Before(deadline) {
+		w, client := p.pick()
+		if w == nil {
+			// ждем, пока проверка здоровья вернет какой-нибудь воркер
+			time.Sleep(p.HealthInterval / 4)
+			continue
+		}
+		var reply SignReply
+		err := p.callClient(client, method, SignArgs{Data: data, SignOptions: p.Options}, &reply)
+		if err == nil {
+			return reply.Hash, nil
+		}
+		lastErr = err
+		switch err.(type) {
+		case rpc.ServerError:
+			// воркер жив, но упал на самом элементе - у другого выйдет то же самое
+			return "", err
+		case callTimeoutError:
+			// медленный только этот вызов, остальные на соединении идут дальше
+			continue
+		}
+		p.markFailed(w, client)
+	}
+	return "", fmt.Errorf("%s(%q): %v", method, data, lastErr)
+}
+
+func (p *WorkerPool) SingleHashOf(data string) (string, error) {
+	return p.call("Signer.SingleHash", data)
+}
+
+func (p *WorkerPool) MultiHashOf(data string) (string, error) {
+	return p.call("Signer.MultiHash", data)
+}
+
+func (p *WorkerPool) remoteStage(method string, convert func(interface{}) string) job {
+	return func(in, out chan interface{}) {
+		wg := &sync.WaitGroup{}
+		for rawData := range in {
+			wg.Add(1)
+			go func(rawData interface{}) {
+				defer wg.Done()
+				defer RecoverItem(out, rawData)
+				hash, err := p.call(method, convert(rawData))
+				if err != nil {
+					panic(err)
+				}
+				out <- hash
+			}(rawData)
+		}
+		wg.Wait()
+	}
+}
+
+// SingleHash - стадия SingleHash, выполняемая удаленными воркерами.
+// Элемент, который не удалось посчитать, становится паникой воркера стадии (см. RecoverItem)
+func (p *WorkerPool) SingleHash(in, out chan interface{}) {
+	p.remoteStage("Signer.SingleHash", func(rawData interface{}) string {
+		return fmt.Sprint(rawData)
+	})(in, out)
+}
+
+// MultiHash - стадия MultiHash, выполняемая удаленными воркерами
+func (p *WorkerPool) MultiHash(in, out chan interface{}) {
+	p.remoteStage("Signer.MultiHash", func(rawData interface{}) string {
+		return rawData.(string)
+	})(in, out)
+}
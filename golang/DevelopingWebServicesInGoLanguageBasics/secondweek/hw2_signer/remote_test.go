@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+func startWorker(t *testing.T) (*SignerServer, string) {
+	return startWorkerWith(t, NewSigner())
+}
+
+func startWorkerWith(t *testing.T, s *Signer) (*SignerServer, string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewSignerServer(s)
+	served := make(chan struct{})
+	go func() {
+		srv.Serve(l)
+		close(served)
+	}()
+	// горутины воркера не должны пережить тест: они читают подменные DataSigner*
+	t.Cleanup(func() {
+		srv.Close()
+		<-served
+	})
+	return srv, l.Addr().String()
+}
+
+func TestWorkerPoolPipeline(t *testing.T) {
+	withFastSigners(t)
+	_, addr1 := startWorker(t)
+	_, addr2 := startWorker(t)
+
+	pool := NewWorkerPool(addr1, addr2)
+	pool.Start()
+	defer pool.Close()
+	if pool.Healthy() != 2 {
+		t.Fatalf("expected 2 healthy workers, got %d", pool.Healthy())
+	}
+
+	var res string
+	ExecutePipeline(
+		sourceOf(0, 1, 1, 2, 3, 5, 8),
+		job(pool.SingleHash),
+		job(pool.MultiHash),
+		job(CombineResults),
+		job(func(in, out chan interface{}) {
+			res = (<-in).(string)
+		}),
+	)
+
+	if expected := runSigner(NewSigner(), 0, 1, 1, 2, 3, 5, 8); res != expected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", res, expected)
+	}
+}
+
+func TestWorkerPoolRedispatch(t *testing.T) {
+	withFastSigners(t)
+	dead, addr1 := startWorker(t)
+	_, addr2 := startWorker(t)
+
+	pool := NewWorkerPool(addr1, addr2)
+	pool.HealthInterval = 10 * time.Millisecond
+	pool.Start()
+	defer pool.Close()
+
+	dead.Close()
+	for i := 0; i < 4; i++ {
+		hash, err := pool.SingleHashOf("1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := NewSigner().SingleHashOf("1"); hash != expected {
+			t.Errorf("results not match\nGot: %v\nExpected: %v", hash, expected)
+		}
+	}
+	if pool.Healthy() != 1 {
+		t.Errorf("dead worker still considered healthy")
+	}
+}
+
+func TestWorkerPoolNoWorkers(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	pool := NewWorkerPool(addr)
+	pool.HealthInterval = 10 * time.Millisecond
+	pool.DispatchTimeout = 50 * time.Millisecond
+	pool.Start()
+	defer pool.Close()
+
+	err = (&Pipeline{Jobs: []job{sourceOf(1), pool.SingleHash}}).Run()
+	if errs, ok := err.(StageErrors); !ok || len(errs) != 1 || errs[0].Item != 1 {
+		t.Errorf("expected stage error for item 1, got %v", err)
+	}
+}
+
+func TestWorkerPoolTimeout(t *testing.T) {
+	withFastSigners(t)
+	release := make(chan struct{})
+	finished := make(chan struct{}, 1)
+	fastCrc32 := DataSignerCrc32
+	DataSignerCrc32 = func(data string) string {
+		if data == "slow" {
+			defer func() { finished <- struct{}{} }()
+			<-release
+		}
+		return fastCrc32(data)
+	}
+	defer func() {
+		close(release)
+		<-finished
+	}()
+	s := NewSigner()
+	s.SingleRecipe = MustParseRecipe("crc32(data)")
+	srv, addr := startWorkerWith(t, s)
+
+	pool := NewWorkerPool(addr)
+	pool.CallTimeout = 50 * time.Millisecond
+	pool.DispatchTimeout = 100 * time.Millisecond
+	pool.Start()
+	defer pool.Close()
+	client := pool.workers[0].client
+
+	if _, err := pool.SingleHashOf("slow"); err == nil {
+		t.Fatal("expected timeout error")
+	}
+	// медленный вызов не рвет соединение для остальных
+	if _, err := pool.SingleHashOf("1"); err != nil {
+		t.Fatal(err)
+	}
+	pool.mu.Lock()
+	sameClient := pool.workers[0].client == client
+	pool.mu.Unlock()
+	srv.mu.Lock()
+	conns := len(srv.conns)
+	srv.mu.Unlock()
+	if !sameClient || conns != 1 || pool.Healthy() != 1 {
+		t.Errorf("connection closed after call timeout: same client %v, %d server conns, %d healthy",
+			sameClient, conns, pool.Healthy())
+	}
+}
+
+func TestWorkerOptions(t *testing.T) {
+	withFastSigners(t)
+	coordinator := NewSigner()
+	coordinator.Salt = "pepper"
+	coordinator.SingleRecipe = MustParseRecipe(`md5(data + salt)`)
+	expected := coordinator.SingleHashOf("1")
+	opts := coordinator.SignOptions()
+
+	// воркер запущен со своей солью и рецептами, но считает с настройками координатора
+	own := NewSigner()
+	own.Salt = "own"
+	svc := &SignService{s: own}
+	var reply SignReply
+	if err := svc.SingleHash(SignArgs{Data: "1", SignOptions: opts}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply.Hash != expected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", reply.Hash, expected)
+	}
+	// своя соль воркера для вызовов без настроек не меняется
+	if err := svc.SingleHash(SignArgs{Data: "1"}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if expected := own.SingleHashOf("1"); reply.Hash != expected || own.Salt != "own" {
+		t.Errorf("worker salt changed\nGot: %v\nExpected: %v", reply.Hash, expected)
+	}
+	if concurrency, _, _ := svc.signers[opts].Md5Limiter.Settings(); concurrency != 1 {
+		t.Errorf("md5 limiter not applied: concurrency %d", concurrency)
+	}
+
+	opts.SingleRecipe = "sha1("
+	if err := svc.SingleHash(SignArgs{Data: "1", SignOptions: opts}, &reply); err == nil {
+		t.Errorf("expected bad recipe error")
+	}
+}
+
+func TestCLIWorkers(t *testing.T) {
+	withFastSigners(t)
+	_, addr := startWorker(t)
+
+	args := []string{"-range", "0:3", "-single-recipe", `crc32(md5(data)) + "~" + crc32(data)`}
+	local := new(bytes.Buffer)
+	if err := run(args, nil, local); err != nil {
+		t.Fatal(err)
+	}
+	remote := new(bytes.Buffer)
+	if err := run(append(args, "-workers", addr), nil, remote); err != nil {
+		t.Fatal(err)
+	}
+	if local.String() != remote.String() {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", remote, local)
+	}
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// SignServer - HTTP API подписи:
+//	POST /sign         {"data": "..."} -> {"input", "single_hash", "multi_hash"}
+//	POST /sign/batch   ["...", ...] -> {"results": [...], "combined": "..."}
+//	POST /sign/stream  {"data": "..."} на строку -> результат на строку по мере готовности,
+//	                   в конце {"combined": "..."}
+type SignServer struct {
+	Signer *Signer
+	// Timeout ограничивает обработку одного запроса; 0 - без ограничения
+	Timeout time.Duration
+	// MaxConcurrent - сколько элементов сервер подписывает одновременно по всем запросам
+	MaxConcurrent int
+	// MaxBatch - сколько элементов можно прислать в /sign/batch и /sign/stream; 0 - без ограничения
+	MaxBatch int
+	// MaxBody ограничивает размер тела запроса в байтах; 0 - без ограничения
+	MaxBody int64
+
+	once sync.Once
+	sem  chan struct{}
+	mux  *http.ServeMux
+	// wg считает подписи, в том числе брошенные по таймауту
+	wg sync.WaitGroup
+}
+
+type signRequest struct {
+	Data string `json:"data"`
+}
+
+type batchResponse struct {
+	Results []signed `json:"results"`
+	// Combined - CombineResults по всем элементам, если все подписались без ошибок
+	Combined string `json:"combined,omitempty"`
+}
+
+func NewSignServer(s *Signer) *SignServer {
+	return &SignServer{
+		Signer:        s,
+		Timeout:       30 * time.Second,
+		MaxConcurrent: 8,
+		MaxBatch:      1000,
+		MaxBody:       10 << 20,
+	}
+}
+
+func (srv *SignServer) init() {
+	srv.once.Do(func() {
+		n := srv.MaxConcurrent
+		if n < 1 {
+			n = 1
+		}
+		srv.sem = make(chan struct{}, n)
+		srv.mux = http.NewServeMux()
+		srv.mux.HandleFunc("/sign", srv.handleSign)
+		srv.mux.HandleFunc("/sign/batch", srv.handleBatch)
+		srv.mux.HandleFunc("/sign/stream", srv.handleStream)
+	})
+}
+
+func (srv *SignServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	srv.init()
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "only POST is allowed"})
+		return
+	}
+	if srv.MaxBody > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, srv.MaxBody)
+	}
+	ctx := r.Context()
+	if srv.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, srv.Timeout)
+		defer cancel()
+	}
+	srv.mux.ServeHTTP(w, r.WithContext(ctx))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if err == context.DeadlineExceeded {
+		status = http.StatusGatewayTimeout
+	}
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// sign подписывает data, дождавшись свободного места среди MaxConcurrent.
+// После отмены ctx подпись бросается на следующем вызове хеш-функции и освобождает место
+func (srv *SignServer) sign(ctx context.Context, data string) (signed, error) {
+	select {
+	case srv.sem <- struct{}{}:
+	case <-ctx.Done():
+		return signed{Input: data}, ctx.Err()
+	}
+
+	type result struct {
+		item signed
+		err  error
+	}
+	done := make(chan result, 1)
+	srv.wg.Add(1)
+	go func() {
+		defer srv.wg.Done()
+		defer func() { <-srv.sem }()
+		res := result{item: signed{Input: data}}
+		func() {
+			defer recoverCall(&res.err)
+			single, err := srv.Signer.SingleHashContext(ctx, data)
+			if err != nil {
+				res.err = err
+				return
+			}
+			multi, err := srv.Signer.MultiHashContext(ctx, single)
+			if err != nil {
+				res.err = err
+				return
+			}
+			res.item = signed{Input: data, Single: single, Multi: multi}
+		}()
+		done <- res
+	}()
+
+	select {
+	case res := <-done:
+		return res.item, res.err
+	case <-ctx.Done():
+		return signed{Input: data}, ctx.Err()
+	}
+}
+
+// Wait ждет все начатые подписи, в том числе те, ответа на которые уже не ждут
+func (srv *SignServer) Wait() {
+	srv.wg.Wait()
+}
+
+func (srv *SignServer) handleSign(w http.ResponseWriter, r *http.Request) {
+	var req signRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	item, err := srv.sign(r.Context(), req.Data)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, item)
+}
+
+// batchLimitError - в запросе больше MaxBatch элементов; дальше лимита тело не читается
+type batchLimitError int
+
+func (e batchLimitError) Error() string {
+	return fmt.Sprintf("more than %d items, at most %d allowed", int(e), int(e))
+}
+
+// isBodyTooLarge - ошибка http.MaxBytesReader, у которой нет своего типа
+func isBodyTooLarge(err error) bool {
+	return err != nil && err.Error() == "http: request body too large"
+}
+
+// writeBodyError отвечает на ошибку чтения тела запроса
+func writeBodyError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	if _, ok := err.(batchLimitError); ok || isBodyTooLarge(err) {
+		status = http.StatusRequestEntityTooLarge
+	}
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// decodeBatch читает JSON массив строк, останавливаясь на элементе сверх MaxBatch
+func (srv *SignServer) decodeBatch(r io.Reader) ([]string, error) {
+	dec := json.NewDecoder(r)
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if tok == nil {
+		return nil, nil
+	}
+	if tok != json.Delim('[') {
+		return nil, errors.New("expected JSON array of strings")
+	}
+	var data []string
+	for dec.More() {
+		if srv.MaxBatch > 0 && len(data) == srv.MaxBatch {
+			return nil, batchLimitError(srv.MaxBatch)
+		}
+		var input string
+		if err := dec.Decode(&input); err != nil {
+			return nil, err
+		}
+		data = append(data, input)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (srv *SignServer) handleBatch(w http.ResponseWriter, r *http.Request) {
+	data, err := srv.decodeBatch(r.Body)
+	if err != nil {
+		writeBodyError(w, err)
+		return
+	}
+
+	resp := batchResponse{Results: make([]signed, len(data))}
+	wg := &sync.WaitGroup{}
+	for i, input := range data {
+		wg.Add(1)
+		go func(i int, input string) {
+			defer wg.Done()
+			item, err := srv.sign(r.Context(), input)
+			if err != nil {
+				item.Error = err.Error()
+			}
+			resp.Results[i] = item
+		}(i, input)
+	}
+	wg.Wait()
+
+	hashes := make([]string, 0, len(data))
+	for _, item := range resp.Results {
+		if item.Error != "" {
+			hashes = nil
+			break
+		}
+		hashes = append(hashes, item.Multi)
+	}
+	if hashes != nil {
+		resp.Combined = combine(hashes)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleStream подписывает строки по мере чтения тела и отдает результаты в порядке строк.
+// HTTP/1 сервер дочитывает тело запроса, прежде чем начать ответ, поэтому там готовые
+// результаты копятся, пока тело не прочитано до конца; по HTTP/2 они уходят сразу
+func (srv *SignServer) handleStream(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	var (
+		readErr    error
+		bodyRead   = make(chan struct{})
+		fullDuplex = r.ProtoMajor >= 2
+		started    bool
+		pending    []signed
+		hashes     []string
+		failed     bool
+	)
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	write := func(v interface{}) {
+		if !started {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			started = true
+		}
+		enc.Encode(v)
+	}
+
+	err := (&Pipeline{Jobs: []job{
+		job(func(in, out chan interface{}) {
+			defer close(bodyRead)
+			dec := json.NewDecoder(r.Body)
+			for n := 0; ; n++ {
+				var req signRequest
+				err := dec.Decode(&req)
+				if err == io.EOF {
+					return
+				}
+				if err == nil && srv.MaxBatch > 0 && n == srv.MaxBatch {
+					err = batchLimitError(srv.MaxBatch)
+				}
+				if err != nil {
+					// ответом будет ошибка, уже начатые подписи не нужны
+					readErr = err
+					cancel()
+					return
+				}
+				if !send(out, req.Data) {
+					return
+				}
+			}
+		}),
+		OrderedMap(cap(srv.sem), cap(srv.sem), func(rawData interface{}) interface{} {
+			item, err := srv.sign(ctx, rawData.(string))
+			if err != nil {
+				item.Error = err.Error()
+			}
+			return item
+		}),
+		job(func(in, out chan interface{}) {
+			for rawData := range in {
+				item := rawData.(signed)
+				if item.Error != "" {
+					failed = true
+				}
+				hashes = append(hashes, item.Multi)
+				pending = append(pending, item)
+				select {
+				case <-bodyRead:
+					if readErr != nil {
+						continue
+					}
+				default:
+					if !fullDuplex {
+						continue
+					}
+				}
+				for _, item := range pending {
+					write(item)
+				}
+				pending = pending[:0]
+				if flusher != nil {
+					flusher.Flush()
+				}
+			}
+		}),
+	}}).Run()
+
+	if readErr != nil {
+		if !started {
+			writeBodyError(w, readErr)
+			return
+		}
+		write(map[string]string{"error": readErr.Error()})
+		return
+	}
+	for _, item := range pending {
+		write(item)
+	}
+	switch {
+	case err != nil:
+		write(map[string]string{"error": err.Error()})
+	case !failed:
+		write(map[string]string{"combined": combine(hashes)})
+	}
+}
+
+// HTTPServer - http.Server для srv с ограничениями на чтение и запись,
+// чтобы медленный клиент не держал соединение дольше Timeout
+func (srv *SignServer) HTTPServer(addr string) *http.Server {
+	hs := &http.Server{
+		Addr:              addr,
+		Handler:           srv,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	if srv.Timeout > 0 {
+		hs.ReadTimeout = srv.Timeout + 10*time.Second
+		hs.WriteTimeout = srv.Timeout + 10*time.Second
+	}
+	return hs
+}
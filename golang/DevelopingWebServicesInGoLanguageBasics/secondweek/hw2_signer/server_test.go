@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func postJSON(t *testing.T, url, body string, res interface{}) int {
+	resp, err := http.Post(url, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(res); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode
+}
+
+func TestSignServer(t *testing.T) {
+	withFastSigners(t)
+	s := NewSigner()
+	ts := httptest.NewServer(NewSignServer(s))
+	defer ts.Close()
+
+	var item signed
+	if code := postJSON(t, ts.URL+"/sign", `{"data":"42"}`, &item); code != http.StatusOK {
+		t.Fatalf("unexpected status %d", code)
+	}
+	single := s.SingleHashOf("42")
+	if expected := (signed{Input: "42", Single: single, Multi: s.MultiHashOf(single)}); item != expected {
+		t.Errorf("results not match\nGot: %+v\nExpected: %+v", item, expected)
+	}
+
+	var batch batchResponse
+	if code := postJSON(t, ts.URL+"/sign/batch", `["0","1","2"]`, &batch); code != http.StatusOK {
+		t.Fatalf("unexpected status %d", code)
+	}
+	if len(batch.Results) != 3 || batch.Results[2].Input != "2" || batch.Results[2].Multi == "" {
+		t.Errorf("unexpected batch results: %+v", batch.Results)
+	}
+	if expected := runSigner(s, 0, 1, 2); batch.Combined != expected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", batch.Combined, expected)
+	}
+
+	resp, err := http.Post(ts.URL+"/sign/stream", "application/x-ndjson",
+		strings.NewReader(`{"data":"0"}`+"\n"+`{"data":"1"}`+"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var lines []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if len(lines) != 3 || !strings.Contains(lines[0], `"input":"0"`) || !strings.Contains(lines[1], `"input":"1"`) {
+		t.Fatalf("unexpected stream:\n%s", strings.Join(lines, "\n"))
+	}
+	var combined map[string]string
+	json.Unmarshal([]byte(lines[2]), &combined)
+	if expected := runSigner(s, 0, 1); combined["combined"] != expected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", combined["combined"], expected)
+	}
+}
+
+func TestSignServerErrors(t *testing.T) {
+	withFastSigners(t)
+	srv := NewSignServer(NewSigner())
+	t.Cleanup(srv.Wait)
+	srv.MaxBatch = 2
+	srv.MaxBody = 64
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	var res map[string]string
+	if code := postJSON(t, ts.URL+"/sign", `{"data":`, &res); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for broken JSON, got %d", code)
+	}
+	if code := postJSON(t, ts.URL+"/sign/batch", `["a","b","c"]`, &res); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413 for oversized batch, got %d", code)
+	}
+	stream := `{"data":"a"}` + "\n" + `{"data":"b"}` + "\n" + `{"data":"c"}` + "\n"
+	if code := postJSON(t, ts.URL+"/sign/stream", stream, &res); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413 for oversized stream, got %d", code)
+	}
+	if code := postJSON(t, ts.URL+"/sign", `{"data":"`+strings.Repeat("x", 64)+`"}`, &res); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413 for oversized body, got %d", code)
+	}
+
+	resp, err := http.Get(ts.URL + "/sign")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 for GET, got %d", resp.StatusCode)
+	}
+}
+
+func TestSignServerTimeout(t *testing.T) {
+	withFastSigners(t)
+	srv := NewSignServer(NewSigner())
+	// брошенные по таймауту подписи должны закончиться до того, как вернутся настоящие DataSigner*
+	t.Cleanup(srv.Wait)
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	fastMd5 := DataSignerMd5
+	DataSignerMd5 = func(data string) string {
+		<-release
+		return fastMd5(data)
+	}
+
+	srv.MaxConcurrent = 1
+	srv.Timeout = 30 * time.Millisecond
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	var res map[string]string
+	// первый запрос не дождался подписи, второй - свободного места
+	for i := 0; i < 2; i++ {
+		if code := postJSON(t, ts.URL+"/sign", `{"data":"x"}`, &res); code != http.StatusGatewayTimeout {
+			t.Errorf("request %d: expected 504, got %d (%v)", i, code, res)
+		}
+	}
+
+	var batch batchResponse
+	postJSON(t, ts.URL+"/sign/batch", `["a"]`, &batch)
+	if len(batch.Results) != 1 || batch.Results[0].Error == "" || batch.Combined != "" {
+		t.Errorf("expected per-item timeout without combined result: %+v", batch)
+	}
+}
+
+// errAfter отдает data, а потом ошибку: читать дальше нее нельзя
+type errAfter struct {
+	data io.Reader
+}
+
+func (r errAfter) Read(p []byte) (int, error) {
+	n, err := r.data.Read(p)
+	if err == io.EOF {
+		return n, errors.New("read past the batch limit")
+	}
+	return n, err
+}
+
+func TestSignServerBatchLimit(t *testing.T) {
+	srv := NewSignServer(NewSigner())
+	srv.MaxBatch = 2
+	_, err := srv.decodeBatch(errAfter{strings.NewReader(`["a", "b", "c",`)})
+	if _, ok := err.(batchLimitError); !ok {
+		t.Errorf("expected batch limit error, got %v", err)
+	}
+	data, err := srv.decodeBatch(strings.NewReader(` ["a", "b"] `))
+	if err != nil || len(data) != 2 || data[1] != "b" {
+		t.Errorf("unexpected batch %q: %v", data, err)
+	}
+	if _, err := srv.decodeBatch(strings.NewReader(`{"data":"a"}`)); err == nil {
+		t.Errorf("expected error for object instead of array")
+	}
+}
+
+func TestSignServerStreamSignsWhileReading(t *testing.T) {
+	withFastSigners(t)
+	started := make(chan struct{}, 1)
+	fastCrc32 := DataSignerCrc32
+	DataSignerCrc32 = func(data string) string {
+		if data == "0" {
+			select {
+			case started <- struct{}{}:
+			default:
+			}
+		}
+		return fastCrc32(data)
+	}
+	srv := NewSignServer(NewSigner())
+	t.Cleanup(srv.Wait)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	body, bodyWriter := io.Pipe()
+	type response struct {
+		lines []string
+		err   error
+	}
+	done := make(chan response, 1)
+	go func() {
+		var res response
+		resp, err := http.Post(ts.URL+"/sign/stream", "application/x-ndjson", body)
+		if err != nil {
+			res.err = err
+			done <- res
+			return
+		}
+		defer resp.Body.Close()
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			res.lines = append(res.lines, scanner.Text())
+		}
+		done <- res
+	}()
+
+	bodyWriter.Write([]byte(`{"data":"0"}` + "\n"))
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Error("first line not signed before the request body ended")
+	}
+	bodyWriter.Write([]byte(`{"data":"1"}` + "\n"))
+	bodyWriter.Close()
+
+	res := <-done
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+	if len(res.lines) != 3 || !strings.Contains(res.lines[0], `"input":"0"`) || !strings.Contains(res.lines[2], "combined") {
+		t.Errorf("unexpected stream:\n%s", strings.Join(res.lines, "\n"))
+	}
+}
+
+func TestSignServerHTTPServer(t *testing.T) {
+	srv := NewSignServer(NewSigner())
+	hs := srv.HTTPServer(":0")
+	if hs.Handler != srv || hs.ReadHeaderTimeout <= 0 || hs.ReadTimeout <= srv.Timeout || hs.WriteTimeout <= srv.Timeout {
+		t.Errorf("unexpected server timeouts: header %s, read %s, write %s",
+			hs.ReadHeaderTimeout, hs.ReadTimeout, hs.WriteTimeout)
+	}
+}
+
+func TestSignServerTimeoutFreesSlot(t *testing.T) {
+	withFastSigners(t)
+	srv := NewSignServer(NewSigner())
+	t.Cleanup(srv.Wait)
+	release, hold := make(chan struct{}), make(chan struct{})
+	defer close(hold)
+	fastMd5, fastCrc32 := DataSignerMd5, DataSignerCrc32
+	slowMd5 := fastMd5("slow")
+	DataSignerMd5 = func(data string) string {
+		if data == "slow" {
+			<-release
+		}
+		return fastMd5(data)
+	}
+	// брошенная подпись не должна дойти до crc32 от md5, иначе она держит место
+	DataSignerCrc32 = func(data string) string {
+		if data == slowMd5 {
+			<-hold
+		}
+		return fastCrc32(data)
+	}
+
+	srv.MaxConcurrent = 1
+	srv.Timeout = 200 * time.Millisecond
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	var res map[string]string
+	if code := postJSON(t, ts.URL+"/sign", `{"data":"slow"}`, &res); code != http.StatusGatewayTimeout {
+		t.Fatalf("expected 504, got %d (%v)", code, res)
+	}
+	close(release)
+	var item signed
+	if code := postJSON(t, ts.URL+"/sign", `{"data":"fast"}`, &item); code != http.StatusOK {
+		t.Errorf("timed out request still holds the only slot: %d", code)
+	}
+}
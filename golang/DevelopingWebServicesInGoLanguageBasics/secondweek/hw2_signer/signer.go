@@ -1,121 +1,190 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"sort"
 	"strings"
 	"sync"
+	"time"
 )
 
+// PipelineStallTimeout включает в ExecutePipeline отладку зависаний (см. Pipeline.StallTimeout)
+var PipelineStallTimeout time.Duration
+
+// ExecutePipeline запускает стадии конвейера и ждет их завершения.
+// Паника в любой стадии останавливает конвейер и пробрасывается вызывающему как StageErrors
+func ExecutePipeline(jobs ...job) {
+	if err := (&Pipeline{Jobs: jobs, StallTimeout: PipelineStallTimeout}).Run(); err != nil {
+		panic(err)
+	}
+}
+
+// Signer хранит настройки одного конвейера подписи
+type Signer struct {
+	// Md5Limiter охраняет DataSignerMd5, который перегревается при параллельных вызовах
+	Md5Limiter *Limiter
+	// Crc32Cache и Md5Cache, если заданы, запоминают уже посчитанные подписи
+	Crc32Cache *Memo
+	Md5Cache   *Memo
+	// SingleRecipe и MultiRecipe заменяют стандартные SingleHashRecipe и MultiHashRecipe
+	SingleRecipe *Recipe
+	MultiRecipe  *Recipe
+	// Salt дописывается к данным перед каждой хеш-функцией, до DataSignerSalt внутри DataSigner*.
+	// Соль своя у каждого подписывающего: воркер считает с солью координатора, не трогая свою
+	Salt string
+}
+
+func NewSigner() *Signer {
+	return &Signer{
+		Md5Limiter: NewLimiter(1, 0, 0),
+	}
+}
+
 var (
-	md5Mutex = sync.Mutex{}
+	defaultSigner    = NewSigner()
+	singleHashRecipe = MustParseRecipe(SingleHashRecipe)
+	multiHashRecipe  = MustParseRecipe(MultiHashRecipe)
 )
 
-func ExecutePipeline(jobs ...job) {
-	wg := &sync.WaitGroup{}
-	var outs = make([]chan interface{}, len(jobs)+1)
-	for i := range outs {
-		outs[i] = make(chan interface{}, 100)
+func (s *Signer) md5(data string) string {
+	return s.md5Context(context.Background(), data)
+}
+
+// md5Context перестает ждать Md5Limiter, как только ctx отменен
+func (s *Signer) md5Context(ctx context.Context, data string) string {
+	data += s.Salt
+	f := func(data string) string {
+		if l := s.Md5Limiter; l != nil {
+			if err := l.AcquireContext(ctx); err != nil {
+				panic(recipeAbort{err})
+			}
+			defer l.Release()
+		}
+		return DataSignerMd5(data)
 	}
-	for i, j := range jobs {
-		wg.Add(1)
-		go func(index int, j job) {
-			j(outs[index], outs[index+1])
-			close(outs[index+1])
-			wg.Done()
-		}(i, j)
+	if s.Md5Cache != nil {
+		return s.Md5Cache.Do(data, f)
 	}
-	wg.Wait()
+	return f(data)
+}
+
+func (s *Signer) crc32(data string) string {
+	data += s.Salt
+	if s.Crc32Cache != nil {
+		return s.Crc32Cache.Do(data, DataSignerCrc32)
+	}
+	return DataSignerCrc32(data)
 }
 
-type crc32res struct {
-	id   int64
-	hash string
+// recipeEnv - хеш-функции рецептов с солью s; md5 ждет Md5Limiter, пока не отменят ctx
+func (s *Signer) recipeEnv(ctx context.Context) *recipeEnv {
+	return &recipeEnv{
+		salt: s.Salt + DataSignerSalt,
+		hash: func(name string) HashFunc {
+			switch name {
+			case "crc32":
+				return s.crc32
+			case "md5":
+				return func(data string) string {
+					return s.md5Context(ctx, data)
+				}
+			}
+			f := lookupHash(name)
+			return func(data string) string {
+				return f(data + s.Salt)
+			}
+		},
+	}
 }
 
-func Crc32Worker(id int64, data string, out chan interface{}, wg *sync.WaitGroup) {
-	res := DataSignerCrc32(data)
-	out <- crc32res{
-		id:   id,
-		hash: res,
+func (s *Signer) singleRecipe() *Recipe {
+	if s.SingleRecipe != nil {
+		return s.SingleRecipe
 	}
-	wg.Done()
-}
-
-func SingleHashWorker(data string, out chan interface{}, wg *sync.WaitGroup) {
-	md5Mutex.Lock()
-	md5 := DataSignerMd5(data)
-	md5Mutex.Unlock()
-	hashCh := make(chan interface{}, 2)
-	wgCrc := &sync.WaitGroup{}
-	wgCrc.Add(2)
-	go Crc32Worker(0, data, hashCh, wgCrc)
-	go Crc32Worker(1, md5, hashCh, wgCrc)
-	wgCrc.Wait()
-	first := (<-hashCh).(crc32res)
-	second := (<-hashCh).(crc32res)
-	var res string
-	if first.id < second.id {
-		res = first.hash + "~" + second.hash
-	} else {
-		res = second.hash + "~" + first.hash
+	return singleHashRecipe
+}
+
+func (s *Signer) multiRecipe() *Recipe {
+	if s.MultiRecipe != nil {
+		return s.MultiRecipe
 	}
-	out <- res
-	wg.Done()
+	return multiHashRecipe
 }
 
-func SingleHash(in, out chan interface{}) {
+func (s *Signer) SingleHashOf(data string) string {
+	return s.singleRecipe().root.eval(data, s.recipeEnv(context.Background()))
+}
+
+// SingleHashContext - SingleHashOf, который бросает работу после отмены ctx
+func (s *Signer) SingleHashContext(ctx context.Context, data string) (string, error) {
+	return s.singleRecipe().evalContext(ctx, data, s.recipeEnv(ctx))
+}
+
+func (s *Signer) SingleHashWorker(rawData interface{}, out chan interface{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+	defer RecoverItem(out, rawData)
+	out <- s.SingleHashOf(fmt.Sprint(rawData))
+}
+
+func (s *Signer) SingleHash(in, out chan interface{}) {
 	wg := &sync.WaitGroup{}
 	for rawData := range in {
 		wg.Add(1)
-		data := fmt.Sprint(rawData.(int))
-		go SingleHashWorker(data, out, wg)
+		go s.SingleHashWorker(rawData, out, wg)
 	}
 	wg.Wait()
 }
 
-func MultiHashWorker(data string, out chan interface{}, wg *sync.WaitGroup) {
-	wgCrc := &sync.WaitGroup{}
-	hashCh := make(chan interface{}, 6)
-	wgCrc.Add(6)
-	for i := 0; i < 6; i++ {
-		go Crc32Worker(int64(i), fmt.Sprint(i) + data, hashCh, wgCrc)
-	}
-	wgCrc.Wait()
-	crcRes := make([]crc32res, 0, 6)
-	for i := 0; i < 6; i++ {
-		crcRes = append(crcRes, (<-hashCh).(crc32res))
-	}
-	sort.Slice(crcRes, func(i, j int) bool {
-		return crcRes[i].id < crcRes[j].id
-	})
-	var res string
-	for _, r := range crcRes {
-		res += r.hash
-	}
-	out <- res
-	wg.Done()
+func SingleHash(in, out chan interface{}) {
+	defaultSigner.SingleHash(in, out)
 }
 
-func MultiHash(in, out chan interface{}) {
+func (s *Signer) MultiHashOf(data string) string {
+	return s.multiRecipe().root.eval(data, s.recipeEnv(context.Background()))
+}
+
+// MultiHashContext - MultiHashOf, который бросает работу после отмены ctx
+func (s *Signer) MultiHashContext(ctx context.Context, data string) (string, error) {
+	return s.multiRecipe().evalContext(ctx, data, s.recipeEnv(ctx))
+}
+
+func (s *Signer) MultiHashWorker(rawData interface{}, out chan interface{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+	defer RecoverItem(out, rawData)
+	out <- s.MultiHashOf(rawData.(string))
+}
+
+func (s *Signer) MultiHash(in, out chan interface{}) {
 	wg := &sync.WaitGroup{}
 	for rawData := range in {
 		wg.Add(1)
-		data := rawData.(string)
-		go MultiHashWorker(data, out, wg)
+		go s.MultiHashWorker(rawData, out, wg)
 	}
 	wg.Wait()
 }
 
+func MultiHash(in, out chan interface{}) {
+	defaultSigner.MultiHash(in, out)
+}
+
+// Sign считает MultiHash(SingleHash(data)) - то, что отдает пара стадий SingleHash и MultiHash
+func (s *Signer) Sign(data string) string {
+	return s.MultiHashOf(s.SingleHashOf(data))
+}
+
 func CombineResults(in, out chan interface{}) {
 	hashes := make([]string, 0, 100)
 	for rawData := range in {
 		data := rawData.(string)
 		hashes = append(hashes, data)
 	}
+	out <- combine(hashes)
+}
+
+func combine(hashes []string) string {
 	sort.Slice(hashes, func(i, j int) bool {
 		return hashes[i] < hashes[j]
 	})
-	res := strings.Join(hashes, "_")
-	out <- res
+	return strings.Join(hashes, "_")
 }
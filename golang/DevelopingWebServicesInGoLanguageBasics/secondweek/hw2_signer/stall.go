@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// StageBlock - на чем, судя по каналам конвейера, стоит стадия
+type StageBlock int
+
+const (
+	// StageRunning - стадия работает или ждет чего-то вне каналов конвейера
+	StageRunning StageBlock = iota
+	// StageFinished - стадия уже завершилась
+	StageFinished
+	// StageSending - выход стадии заполнен, она стоит на out <- ..., следующая стадия не читает вход
+	StageSending
+	// StageReceiving - для стадии нет элемента: она ждет на <-in, пока предыдущая что-нибудь отдаст
+	StageReceiving
+	// StageNotReceiving - для стадии есть элемент, но она не читает in
+	StageNotReceiving
+)
+
+func (b StageBlock) String() string {
+	switch b {
+	case StageRunning:
+		return "running"
+	case StageFinished:
+		return "finished"
+	case StageSending:
+		return "blocked on send to out"
+	case StageReceiving:
+		return "blocked on receive from in"
+	case StageNotReceiving:
+		return "not receiving from in"
+	}
+	return "unknown"
+}
+
+// StageStall - состояние одной стадии в момент зависания
+type StageStall struct {
+	Stage int
+	Block StageBlock
+	// Pending - сколько элементов лежит в выходе стадии
+	Pending int
+}
+
+// StallError - конвейер за StallTimeout не сдвинулся с места
+type StallError struct {
+	Stalled time.Duration
+	Stages  []StageStall
+	// Stacks - стеки всех горутин в момент зависания
+	Stacks []byte
+}
+
+func (e *StallError) Error() string {
+	var blocked []string
+	for _, st := range e.Stages {
+		if st.Block != StageFinished {
+			blocked = append(blocked, fmt.Sprintf("stage %d %s", st.Stage, st.Block))
+		}
+	}
+	return fmt.Sprintf("pipeline stalled for %s: %s", e.Stalled, strings.Join(blocked, ", "))
+}
+
+// Dump печатает состояние каждой стадии и стеки горутин
+func (e *StallError) Dump(w io.Writer) {
+	fmt.Fprintf(w, "pipeline stalled for %s\n", e.Stalled)
+	for _, st := range e.Stages {
+		fmt.Fprintf(w, "  stage %d: %s (%d items in out)\n", st.Stage, st.Block, st.Pending)
+	}
+	fmt.Fprintf(w, "\n%s\n", e.Stacks)
+}
+
+func newStallError(stages []*stageState, stalled time.Duration) *StallError {
+	err := &StallError{Stalled: stalled}
+	for i, st := range stages {
+		err.Stages = append(err.Stages, StageStall{
+			Stage:   st.index,
+			Block:   st.block(i == 0),
+			Pending: len(st.out),
+		})
+	}
+	err.Stacks = goroutineStacks()
+	return err
+}
+
+func (st *stageState) block(first bool) StageBlock {
+	select {
+	case <-st.done:
+		return StageFinished
+	default:
+	}
+	if len(st.out) == cap(st.out) {
+		return StageSending
+	}
+	if first {
+		// вход первой стадии всегда закрыт
+		return StageRunning
+	}
+	select {
+	case <-st.relayDone:
+		// relay закончил - вход закрыт, стадия работает уже без него
+		return StageRunning
+	default:
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.holding {
+		return StageNotReceiving
+	}
+	return StageReceiving
+}
+
+func goroutineStacks() []byte {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
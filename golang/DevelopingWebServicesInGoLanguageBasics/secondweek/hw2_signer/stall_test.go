@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPipelineStall(t *testing.T) {
+	checkGoroutineLeaks(t)
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+
+	output := new(bytes.Buffer)
+	err := (&Pipeline{
+		Jobs: []job{
+			job(func(in, out chan interface{}) {
+				for i := 0; i < 200; i++ {
+					out <- i
+				}
+			}),
+			// забыли вычитать вход: взяли один элемент и ждем чего-то другого
+			job(func(in, out chan interface{}) {
+				out <- <-in
+				<-release
+			}),
+			job(func(in, out chan interface{}) {
+				for range in {
+				}
+			}),
+		},
+		StallTimeout: 50 * time.Millisecond,
+		StallOutput:  output,
+	}).Run()
+
+	stall, ok := err.(*StallError)
+	if !ok {
+		t.Fatalf("expected StallError, got %v", err)
+	}
+	blocks := make([]StageBlock, len(stall.Stages))
+	for i, st := range stall.Stages {
+		blocks[i] = st.Block
+	}
+	expected := []StageBlock{StageSending, StageNotReceiving, StageReceiving}
+	for i := range expected {
+		if blocks[i] != expected[i] {
+			t.Errorf("results not match\nGot: %v\nExpected: %v", blocks, expected)
+			break
+		}
+	}
+	if !strings.Contains(output.String(), "stage 1: not receiving from in") ||
+		!strings.Contains(output.String(), "goroutine ") {
+		t.Errorf("stall dump lacks stage state or stacks:\n%s", output)
+	}
+}
+
+func TestPipelineNoFalseStall(t *testing.T) {
+	checkGoroutineLeaks(t)
+	withFastSigners(t)
+	old := PipelineStallTimeout
+	PipelineStallTimeout = 100 * time.Millisecond
+	t.Cleanup(func() { PipelineStallTimeout = old })
+
+	var got []int
+	ExecutePipeline(
+		sourceOf(1, 2, 3, 4, 5),
+		job(func(in, out chan interface{}) {
+			for v := range in {
+				time.Sleep(20 * time.Millisecond)
+				out <- v
+			}
+		}),
+		collectInts(&got),
+	)
+	if len(got) != 5 {
+		t.Errorf("expected 5 items, got %v", got)
+	}
+	if res := runSigner(NewSigner(), 0, 1); res == "" {
+		t.Errorf("empty result")
+	}
+}
+
+func TestPackageGoroutines(t *testing.T) {
+	before := packageGoroutines()
+	stop := make(chan struct{})
+	go func() {
+		<-stop
+	}()
+
+	found := 0
+	for id := range packageGoroutines() {
+		if _, ok := before[id]; !ok {
+			found++
+		}
+	}
+	close(stop)
+	if found != 1 {
+		t.Errorf("expected 1 new goroutine, found %d", found)
+	}
+}
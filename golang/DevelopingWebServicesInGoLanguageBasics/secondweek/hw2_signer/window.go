@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// Window описывает, когда CombineResultsWindowed выпускает очередной результат
+type Window struct {
+	// Size - сколько последних хешей объединяется; 0 - все, накопленные с прошлой выдачи
+	Size int
+	// Slide - через сколько новых хешей выдавать результат скользящего окна;
+	// 0 - окно непересекающееся (выдача каждые Size хешей)
+	Slide int
+	// Interval - выдавать накопленное не реже чем раз в Interval
+	Interval time.Duration
+}
+
+func (w Window) validate() error {
+	switch {
+	case w.Size < 0:
+		return errors.New("window: negative Size")
+	case w.Slide < 0:
+		return errors.New("window: negative Slide")
+	case w.Interval < 0:
+		return errors.New("window: negative Interval")
+	case w.Slide > 0 && w.Size == 0:
+		return errors.New("window: sliding window needs Size > 0")
+	case w.Slide > w.Size:
+		return errors.New("window: Slide larger than Size skips hashes")
+	}
+	return nil
+}
+
+// CombineResultsWindowed работает как CombineResults, но выдает результат
+// по мере заполнения окна, а не только после закрытия входа.
+// Пустой Window дает то же поведение, что и CombineResults
+func CombineResultsWindowed(w Window) (job, error) {
+	if err := w.validate(); err != nil {
+		return nil, err
+	}
+	if w.Size == 0 && w.Interval == 0 {
+		return CombineResults, nil
+	}
+	return func(in, out chan interface{}) {
+		var tick <-chan time.Time
+		if w.Interval > 0 {
+			ticker := time.NewTicker(w.Interval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+
+		hashes := make([]string, 0, w.Size)
+		fresh := 0
+		emit := func() {
+			if fresh == 0 {
+				return
+			}
+			batch := make([]string, len(hashes))
+			copy(batch, hashes)
+			out <- combine(batch)
+			fresh = 0
+			// при Slide == Size окна не пересекаются, как и без Slide: выданное в следующее не попадает
+			if w.Slide == 0 || w.Slide == w.Size {
+				hashes = hashes[:0]
+			}
+		}
+
+		// паника на элементе ловится здесь же, а не перезапуском стадии, иначе в SkipItem терялось бы окно
+		add := func(rawData interface{}) (added bool) {
+			defer RecoverItem(out, rawData)
+			hashes = append(hashes, rawData.(string))
+			return true
+		}
+
+		for {
+			select {
+			case rawData, ok := <-in:
+				if !ok {
+					emit()
+					return
+				}
+				if !add(rawData) {
+					continue
+				}
+				fresh++
+				if w.Slide > 0 && len(hashes) > w.Size {
+					hashes = hashes[len(hashes)-w.Size:]
+				}
+				switch {
+				case w.Slide > 0 && fresh >= w.Slide:
+					emit()
+				case w.Slide == 0 && w.Size > 0 && len(hashes) >= w.Size:
+					emit()
+				}
+			case <-tick:
+				emit()
+			}
+		}
+	}, nil
+}
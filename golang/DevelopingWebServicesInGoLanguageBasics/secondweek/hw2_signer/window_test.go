@@ -0,0 +1,106 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func combineWindowed(t *testing.T, w Window, source job) []interface{} {
+	combine, err := CombineResultsWindowed(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []interface{}
+	ExecutePipeline(
+		source,
+		combine,
+		job(func(in, out chan interface{}) {
+			for v := range in {
+				got = append(got, v)
+			}
+		}),
+	)
+	return got
+}
+
+func sendHashes(hashes ...string) job {
+	return func(in, out chan interface{}) {
+		for _, h := range hashes {
+			out <- h
+		}
+	}
+}
+
+func TestCombineResultsWindowed(t *testing.T) {
+	cases := []struct {
+		name     string
+		window   Window
+		expected []interface{}
+	}{
+		{"whole stream", Window{}, []interface{}{"a_b_c_d_e"}},
+		{"tumbling", Window{Size: 2}, []interface{}{"b_c", "a_d", "e"}},
+		{"sliding", Window{Size: 3, Slide: 2}, []interface{}{"b_c", "a_b_d", "a_d_e"}},
+		{"slide equals size", Window{Size: 2, Slide: 2}, []interface{}{"b_c", "a_d", "e"}},
+	}
+	for _, c := range cases {
+		got := combineWindowed(t, c.window, sendHashes("c", "b", "d", "a", "e"))
+		if !reflect.DeepEqual(got, c.expected) {
+			t.Errorf("%s: results not match\nGot: %v\nExpected: %v", c.name, got, c.expected)
+		}
+	}
+}
+
+func TestCombineResultsWindowedInterval(t *testing.T) {
+	// вторая половина хешей уходит только после того, как по таймеру
+	// выдана первая, то есть еще до закрытия входа
+	firstEmitted := make(chan struct{})
+	source := job(func(in, out chan interface{}) {
+		out <- "c"
+		out <- "b"
+		<-firstEmitted
+		out <- "d"
+		out <- "a"
+		out <- "e"
+	})
+	signal := job(func(in, out chan interface{}) {
+		first := true
+		for v := range in {
+			if first {
+				close(firstEmitted)
+				first = false
+			}
+			out <- v
+		}
+	})
+
+	combine, err := CombineResultsWindowed(Window{Interval: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []interface{}
+	ExecutePipeline(source, combine, signal, job(func(in, out chan interface{}) {
+		for v := range in {
+			got = append(got, v)
+		}
+	}))
+
+	expected := []interface{}{"b_c", "a_d_e"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", got, expected)
+	}
+}
+
+func TestWindowValidation(t *testing.T) {
+	for _, w := range []Window{
+		{Size: -1},
+		{Slide: -1, Size: 2},
+		{Interval: -time.Second},
+		{Slide: 1},
+		{Size: 2, Slide: 3},
+	} {
+		if _, err := CombineResultsWindowed(w); err == nil {
+			t.Errorf("%+v: expected error", w)
+		}
+	}
+}
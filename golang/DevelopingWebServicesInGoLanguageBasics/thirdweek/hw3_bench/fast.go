@@ -98,53 +98,79 @@ func FastSearch(out io.Writer) {
 	if err != nil {
 		panic(err)
 	}
-	reader := bufio.NewReader(file)
-
-	seenBrowsers := make(map[string]struct{}, 100)
-	line := make([]byte, 0, 1000)
-	users := make([]Record, 0, 1000)
-
-	for {
-		line, err = reader.ReadSlice('\n')
-		if err == io.EOF {
-			break
-		}
-		var user Record
-		err = user.UnmarshalJSON(line)
-		if err != nil {
-			panic(err)
-		}
-		users = append(users, user)
+	defer file.Close()
+	if err := StreamSearch(file, out); err != nil {
+		panic(err)
 	}
+}
 
-	fmt.Fprintln(out, "found users:")
+// StreamSearch - FastSearch по любому потоку за один проход: пользователь разбирается,
+// проверяется и печатается сразу, в памяти остаются только текущая строка и уже виденные браузеры
+func StreamSearch(in io.Reader, out io.Writer) error {
+	return StreamSearchWith(in, out, EasyJSONDecoder)
+}
 
-	for userIndex := range users {
-		isAndroid := false
-		isMSIE := false
+// StreamSearchWith - StreamSearch, разбирающий строки выбранным декодером
+func StreamSearchWith(in io.Reader, out io.Writer, decoder SearchDecoder) error {
+	reader := bufio.NewReaderSize(in, 64*1024)
+	w := bufio.NewWriter(out)
 
-		for i := range users[userIndex].Browsers {
-			switch {
-			case strings.Contains(users[userIndex].Browsers[i], "Android"):
-				isAndroid = true
-			case strings.Contains(users[userIndex].Browsers[i], "MSIE"):
-				isMSIE = true
-			default:
-				continue
+	seenBrowsers := make(map[string]struct{}, 100)
+	var (
+		buf     []byte
+		user    Record
+		scanner userScanner
+	)
+	w.WriteString("found users:\n")
+	for userIndex := 0; ; userIndex++ {
+		line, err := readLine(reader, &buf)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if len(line) > 0 && decoder == ScannerDecoder {
+			if err := scanner.scan(line); err != nil {
+				return fmt.Errorf("line %d: %v", userIndex, err)
 			}
-
-			if _, seenBefore := seenBrowsers[users[userIndex].Browsers[i]]; !seenBefore {
-				seenBrowsers[users[userIndex].Browsers[i]] = struct{}{}
+			if scanner.match(seenBrowsers) {
+				writeUserBytes(w, userIndex, scanner.name, scanner.email)
+			}
+		} else if len(line) > 0 {
+			// слайс браузеров переиспользуется, поля прошлого пользователя не должны остаться
+			user = Record{Browsers: user.Browsers[:0]}
+			if err := user.UnmarshalJSON(line); err != nil {
+				return err
+			}
+			if matchUser(user.Browsers, seenBrowsers) {
+				writeUser(w, userIndex, user.Name, user.Email)
 			}
 		}
+		if err == io.EOF {
+			break
+		}
+	}
+
+	fmt.Fprintln(w, "\nTotal unique browsers", len(seenBrowsers))
+	return w.Flush()
+}
 
-		if !isAndroid || !isMSIE {
+// matchUser запоминает браузеры Android и MSIE и говорит, есть ли у пользователя оба
+func matchUser(browsers []string, seenBrowsers map[string]struct{}) bool {
+	isAndroid := false
+	isMSIE := false
+
+	for i := range browsers {
+		switch {
+		case strings.Contains(browsers[i], "Android"):
+			isAndroid = true
+		case strings.Contains(browsers[i], "MSIE"):
+			isMSIE = true
+		default:
 			continue
 		}
 
-		posAt := strings.IndexByte(users[userIndex].Email, '@')
-		fmt.Fprintf(out, "[%d] %s <%s [at] %s>\n", userIndex, users[userIndex].Name, users[userIndex].Email[0:posAt], users[userIndex].Email[posAt+1:])
+		if _, seenBefore := seenBrowsers[browsers[i]]; !seenBefore {
+			seenBrowsers[browsers[i]] = struct{}{}
+		}
 	}
-
-	fmt.Fprintln(out, "\nTotal unique browsers", len(seenBrowsers))
+	return isAndroid && isMSIE
 }
@@ -2,4 +2,7 @@ module hw3_bench
 
 go 1.15
 
-require github.com/mailru/easyjson v0.7.6
+require (
+	github.com/klauspost/compress v1.13.6
+	github.com/mailru/easyjson v0.7.6
+)
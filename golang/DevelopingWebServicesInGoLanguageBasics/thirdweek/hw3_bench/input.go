@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/mailru/easyjson/jwriter"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// Input - откуда и в каком формате читать лог. Любой источник превращается в поток
+// JSON строк, так что StreamSearchWith и Query.Search не знают, откуда пришли данные:
+// src - путь к файлу, http(s):// URL или - для stdin. Сжатие gzip и zstd определяется по сигнатуре.
+// Формат - json (JSON на строку) или csv с заголовком;
+// если Format пустой, он определяется по расширению, Content-Type ответа или первому байту данных
+type Input struct {
+	Format string
+	// Columns - какое поле записи в какой колонке CSV лежит: {"name": "Full Name"}.
+	// Колонки без сопоставления попадают в поле с именем колонки
+	Columns map[string]string
+	// ListSeparator разделяет элементы полей-массивов (browsers) в ячейке CSV, по умолчанию ;
+	ListSeparator string
+	// Client - для http(s) источников, по умолчанию defaultInputClient
+	Client *http.Client
+	// Timeout ограничивает http(s) запрос целиком, вместе с чтением тела; 0 - без ограничения
+	Timeout time.Duration
+}
+
+// defaultInputClient не ждет соединения и заголовков ответа бесконечно, а тело большого лога
+// читает сколько потребуется; общий предел задает Input.Timeout
+var defaultInputClient = &http.Client{Transport: func() http.RoundTripper {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.ResponseHeaderTimeout = 30 * time.Second
+	return t
+}()}
+
+// csvListFields - поля, которые в JSON логе - массивы строк
+var csvListFields = map[string]bool{"browsers": true}
+
+// Open открывает src; stdin используется для src == -
+func (in *Input) Open(src string, stdin io.Reader) (io.ReadCloser, error) {
+	c := &inputCloser{}
+	var contentType string
+	switch {
+	case src == "-":
+		c.Reader = stdin
+	case strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://"):
+		resp, cancel, err := in.get(src)
+		if err != nil {
+			return nil, err
+		}
+		c.Reader, contentType = resp.Body, resp.Header.Get("Content-Type")
+		c.closers = append(c.closers, func() error { cancel(); return nil }, resp.Body.Close)
+	default:
+		f, err := os.Open(src)
+		if err != nil {
+			return nil, err
+		}
+		c.Reader, c.closers = f, append(c.closers, f.Close)
+	}
+
+	if err := in.decode(src, contentType, c); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// get запрашивает src; cancel отменяет запрос вместе с чтением тела ответа
+func (in *Input) get(src string) (*http.Response, context.CancelFunc, error) {
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if in.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, in.Timeout)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src, nil)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	client := in.Client
+	if client == nil {
+		client = defaultInputClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		cancel()
+		return nil, nil, fmt.Errorf("input: GET %s: %s", src, resp.Status)
+	}
+	return resp, cancel, nil
+}
+
+// decode заменяет c.Reader на поток JSON строк, добавляя в c то, что надо закрыть
+func (in *Input) decode(src, contentType string, c *inputCloser) error {
+	reader := bufio.NewReaderSize(c.Reader, 64*1024)
+	magic, _ := reader.Peek(len(zstdMagic))
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return err
+		}
+		reader = bufio.NewReaderSize(gz, 64*1024)
+	case bytes.HasPrefix(magic, zstdMagic):
+		// одна горутина: поиск все равно читает поток последовательно
+		zr, err := zstd.NewReader(reader, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return err
+		}
+		c.closers = append(c.closers, func() error { zr.Close(); return nil })
+		reader = bufio.NewReaderSize(zr, 64*1024)
+	}
+
+	format := in.Format
+	if format == "" {
+		format = detectFormat(src, contentType, reader)
+	}
+	switch format {
+	case "json":
+		c.Reader = reader
+		return nil
+	case "csv":
+		r, err := in.csv(reader)
+		c.Reader = r
+		return err
+	}
+	return fmt.Errorf("input: unknown format %q, expected json or csv", format)
+}
+
+// detectFormat: расширение (без .gz и .zst), затем Content-Type, затем первый непробельный байт
+func detectFormat(src, contentType string, r *bufio.Reader) string {
+	name := strings.ToLower(src)
+	if strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://") {
+		if i := strings.IndexAny(name, "?#"); i >= 0 {
+			name = name[:i]
+		}
+	}
+	name = strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ".zst")
+	switch path.Ext(name) {
+	case ".csv":
+		return "csv"
+	case ".json", ".jsonl", ".ndjson":
+		return "json"
+	}
+
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		switch {
+		case mediaType == "text/csv":
+			return "csv"
+		case strings.Contains(mediaType, "json"):
+			return "json"
+		}
+	}
+
+	// пустой ввод или ошибку чтения оставляем поиску
+	head, _ := r.Peek(512)
+	if head = bytes.TrimLeft(head, " \t\r\n"); len(head) == 0 || head[0] == '{' {
+		return "json"
+	}
+	return "csv"
+}
+
+// csv превращает CSV с заголовком в JSON строки: строка CSV - одна строка лога
+func (in *Input) csv(r io.Reader) (io.Reader, error) {
+	cr := csv.NewReader(r)
+	cr.ReuseRecord = true
+	header, err := cr.Read()
+	if err == io.EOF {
+		return bytes.NewReader(nil), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	byColumn := make(map[string]string, len(in.Columns))
+	for field, column := range in.Columns {
+		byColumn[column] = field
+	}
+	fields := make([]string, len(header))
+	for i, column := range header {
+		if field, ok := byColumn[column]; ok {
+			fields[i] = field
+			delete(byColumn, column)
+		} else {
+			fields[i] = column
+		}
+	}
+	for column, field := range byColumn {
+		return nil, fmt.Errorf("input: csv column %q for field %q not found", column, field)
+	}
+
+	sep := in.ListSeparator
+	if sep == "" {
+		sep = ";"
+	}
+	return &csvLines{reader: cr, fields: fields, sep: sep}, nil
+}
+
+// csvLines отдает записи CSV как JSON строки по одной, не читая весь файл
+type csvLines struct {
+	reader *csv.Reader
+	fields []string
+	sep    string
+	w      jwriter.Writer
+	buf    []byte
+	line   []byte
+}
+
+func (c *csvLines) Read(p []byte) (int, error) {
+	for len(c.line) == 0 {
+		record, err := c.reader.Read()
+		if err != nil {
+			return 0, err
+		}
+		c.w.Buffer.Buf = c.buf[:0]
+		c.w.RawByte('{')
+		for i, value := range record {
+			if i > 0 {
+				c.w.RawByte(',')
+			}
+			c.w.String(c.fields[i])
+			c.w.RawByte(':')
+			if !csvListFields[c.fields[i]] {
+				c.w.String(value)
+				continue
+			}
+			c.w.RawByte('[')
+			if value != "" {
+				for j, item := range strings.Split(value, c.sep) {
+					if j > 0 {
+						c.w.RawByte(',')
+					}
+					c.w.String(item)
+				}
+			}
+			c.w.RawByte(']')
+		}
+		c.w.RawString("}\n")
+		c.line = c.w.Buffer.BuildBytes()
+		c.buf = c.line[:0]
+	}
+	n := copy(p, c.line)
+	c.line = c.line[n:]
+	return n, nil
+}
+
+// inputCloser закрывает все, что открыли Open и decode, в обратном порядке
+type inputCloser struct {
+	io.Reader
+	closers []func() error
+}
+
+func (c *inputCloser) Close() error {
+	var err error
+	for i := len(c.closers) - 1; i >= 0; i-- {
+		if cerr := c.closers[i](); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const usersCSV = `Full Name,E-mail,User Agents,country
+Ann,ann@a.com,Android 4;MSIE 7,Kenya
+Bob,bob@b.com,,Peru
+"Cid, Jr.",cid@c.com,"MSIE 8;Mozilla ""Android"" 5",Kenya
+`
+
+var usersCSVColumns = map[string]string{"name": "Full Name", "email": "E-mail", "browsers": "User Agents"}
+
+const usersCSVExpected = "found users:\n[0] Ann <ann [at] a.com>\n[2] Cid, Jr. <cid [at] c.com>\n\nTotal unique browsers 4\n"
+
+func gzipped(t testing.TB, data []byte) []byte {
+	buf := new(bytes.Buffer)
+	gz := gzip.NewWriter(buf)
+	if _, err := gz.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func searchInput(t *testing.T, input *Input, src string, stdin []byte) string {
+	in, err := input.Open(src, bytes.NewReader(stdin))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	out := new(bytes.Buffer)
+	if err := StreamSearch(in, out); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestInputGzip(t *testing.T) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slowOut := new(bytes.Buffer)
+	SlowSearch(slowOut)
+
+	dir, err := ioutil.TempDir("", "hw3_bench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// сжатие определяется по сигнатуре, а не по имени
+	for _, name := range []string{"users.txt.gz", "users"} {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, gzipped(t, data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if out := searchInput(t, &Input{}, path, nil); out != slowOut.String() {
+			t.Errorf("%s: results not match\nGot:\n%v\nExpected:\n%v", name, out, slowOut)
+		}
+	}
+	if out := searchInput(t, &Input{}, "-", gzipped(t, data)); out != slowOut.String() {
+		t.Errorf("stdin: results not match\nGot:\n%v\nExpected:\n%v", out, slowOut)
+	}
+}
+
+func zstdCompressed(t testing.TB, data []byte) []byte {
+	buf := new(bytes.Buffer)
+	zw, err := zstd.NewWriter(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestInputZstd(t *testing.T) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slowOut := new(bytes.Buffer)
+	SlowSearch(slowOut)
+
+	dir, err := ioutil.TempDir("", "hw3_bench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "users.txt.zst")
+	if err := ioutil.WriteFile(path, zstdCompressed(t, data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if out := searchInput(t, &Input{}, path, nil); out != slowOut.String() {
+		t.Errorf("file: results not match\nGot:\n%v\nExpected:\n%v", out, slowOut)
+	}
+	if out := searchInput(t, &Input{}, "-", zstdCompressed(t, data)); out != slowOut.String() {
+		t.Errorf("stdin: results not match\nGot:\n%v\nExpected:\n%v", out, slowOut)
+	}
+
+	in, err := (&Input{}).Open("-", bytes.NewReader(append(zstdMagic, 0, 0, 0)))
+	if err == nil {
+		err = StreamSearch(in, ioutil.Discard)
+		in.Close()
+	}
+	if err == nil {
+		t.Errorf("expected error for broken zstd stream")
+	}
+}
+
+func TestInputCSV(t *testing.T) {
+	input := &Input{Columns: usersCSVColumns}
+	for _, stdin := range [][]byte{[]byte(usersCSV), gzipped(t, []byte(usersCSV))} {
+		if out := searchInput(t, input, "-", stdin); out != usersCSVExpected {
+			t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out, usersCSVExpected)
+		}
+	}
+
+	// тот же CSV через язык запросов, немаппированная колонка country - поле как есть
+	in, err := input.Open("-", strings.NewReader(usersCSV))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := new(bytes.Buffer)
+	if err := MustParseQuery(`country = Kenya and browsers contains Android`).Search(in, out); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "found users:\n[0] Ann <ann [at] a.com>\n[2] Cid, Jr. <cid [at] c.com>\n\nTotal found 2\n"; out.String() != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out, expected)
+	}
+
+	input = &Input{Format: "csv", Columns: map[string]string{"name": "Name"}}
+	if _, err := input.Open("-", strings.NewReader(usersCSV)); err == nil {
+		t.Errorf("expected missing column error")
+	}
+	input = &Input{Format: "xml"}
+	if _, err := input.Open("-", strings.NewReader(usersCSV)); err == nil {
+		t.Errorf("expected unknown format error")
+	}
+}
+
+func TestInputHTTP(t *testing.T) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slowOut := new(bytes.Buffer)
+	SlowSearch(slowOut)
+
+	gzData := gzipped(t, data)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/users.ndjson":
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.Write(data)
+		case "/users.ndjson.gz":
+			w.Write(gzData)
+		case "/export":
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Write([]byte(usersCSV))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	input := &Input{Client: ts.Client()}
+	for _, path := range []string{"/users.ndjson", "/users.ndjson.gz?v=1"} {
+		if out := searchInput(t, input, ts.URL+path, nil); out != slowOut.String() {
+			t.Errorf("%s: results not match\nGot:\n%v\nExpected:\n%v", path, out, slowOut)
+		}
+	}
+	input.Columns = usersCSVColumns
+	if out := searchInput(t, input, ts.URL+"/export", nil); out != usersCSVExpected {
+		t.Errorf("csv: results not match\nGot:\n%v\nExpected:\n%v", out, usersCSVExpected)
+	}
+	if _, err := input.Open(ts.URL+"/missing", nil); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("expected 404 error, got %v", err)
+	}
+}
+
+func TestInputHTTPTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// начало лога, а потом сервер замолкает
+		w.Write([]byte(`{"name":"Ann","email":"a@b","browsers":["Android","MSIE"]}` + "\n"))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+
+	input := &Input{Client: ts.Client(), Timeout: 50 * time.Millisecond}
+	in, err := input.Open(ts.URL+"/users.ndjson", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	done := make(chan error, 1)
+	go func() {
+		done <- StreamSearch(in, ioutil.Discard)
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("expected timeout error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("search hangs on stalled http input")
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	cases := []struct {
+		src, contentType, data, format string
+	}{
+		{"users.csv", "", `{"name":"Ann"}`, "csv"},
+		{"users.CSV.gz", "", "", "csv"},
+		{"users.jsonl.zst", "", "name,email\n", "json"},
+		{"http://host/users.csv.zst?v=1", "", "", "csv"},
+		{"http://host/users.jsonl?format=csv", "text/csv", "name", "json"},
+		{"http://host/export", "text/csv", "", "csv"},
+		{"http://host/export", "application/json", "name", "json"},
+		{"users.txt", "", "\n  {\"name\":\"Ann\"}", "json"},
+		{"-", "", "name,email\n", "csv"},
+		{"-", "", "", "json"},
+	}
+	for _, c := range cases {
+		r := bufio.NewReader(strings.NewReader(c.data))
+		if format := detectFormat(c.src, c.contentType, r); format != c.format {
+			t.Errorf("%s %s %q: got %s, expected %s", c.src, c.contentType, c.data, format, c.format)
+		}
+	}
+}
+
+func TestCLIFormats(t *testing.T) {
+	out := new(bytes.Buffer)
+	err := run([]string{"-file", "-", "-format", "csv", "-columns", "name=Full Name, email=E-mail,browsers=User Agents"}, strings.NewReader(usersCSV), out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != usersCSVExpected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out, usersCSVExpected)
+	}
+	if err := run([]string{"-file", "-", "-columns", "name"}, strings.NewReader(usersCSV), ioutil.Discard); err == nil {
+		t.Errorf("expected bad column mapping error")
+	}
+}
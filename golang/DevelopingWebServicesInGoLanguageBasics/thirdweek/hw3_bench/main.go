@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ищет пользователей в логе по запросу (см. ParseQuery):
+//	hw3_bench 'browsers contains "Chrome" and country = "Kenya"'
+//	hw3_bench -file users.txt 'browsers contains Android and browsers contains MSIE'
+//	cat users.txt | hw3_bench -file - 'not company = Jatri'
+// без запроса - пользователей с Android и MSIE, как FastSearch:
+//	zcat huge.txt.gz | hw3_bench -file -
+// лог может быть сжат gzip или zstd, лежать по http(s) URL или быть CSV (см. Input):
+//	hw3_bench -file users.csv.gz -columns 'name=Full Name,browsers=User Agents'
+//	hw3_bench -file http://logs/users.ndjson -timeout 1m 'country = Kenya'
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("hw3_bench", flag.ContinueOnError)
+	file := fs.String("file", filePath, "users log: path, http(s) URL or - for stdin")
+	format := fs.String("format", "", "log format: json or csv, detected if empty")
+	columns := fs.String("columns", "", "csv columns of record fields: field=column,...")
+	decoderName := fs.String("decoder", EasyJSONDecoder.String(), "decoder for search without query: easyjson or scanner")
+	timeout := fs.Duration("timeout", 0, "limit for reading an http(s) log, 0 - no limit")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	decoder, err := ParseSearchDecoder(*decoderName)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		return errors.New("usage: hw3_bench [-file users.txt] [-format json|csv] [-columns field=column,...] [-decoder easyjson|scanner] [-timeout 1m] ['query']")
+	}
+	var q *Query
+	if fs.NArg() == 1 {
+		if q, err = ParseQuery(fs.Arg(0)); err != nil {
+			return err
+		}
+	}
+
+	input := &Input{Format: *format, Timeout: *timeout}
+	if input.Columns, err = parseColumns(*columns); err != nil {
+		return err
+	}
+	in, err := input.Open(*file, stdin)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if q == nil {
+		return StreamSearchWith(in, stdout, decoder)
+	}
+	return q.Search(in, stdout)
+}
+
+// parseColumns разбирает -columns: name=Full Name,browsers=User Agents
+func parseColumns(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	columns := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		i := strings.IndexByte(pair, '=')
+		if i <= 0 || i == len(pair)-1 {
+			return nil, fmt.Errorf("bad column mapping %q, expected field=column", pair)
+		}
+		columns[strings.TrimSpace(pair[:i])] = strings.TrimSpace(pair[i+1:])
+	}
+	return columns, nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ParallelSearch - FastSearch по файлу path, разбитому на workers кусков по границам строк.
+// Куски разбираются одновременно, а результат склеивается так, что вывод совпадает
+// с SlowSearch байт в байт: с той же нумерацией строк и тем же числом уникальных браузеров
+func ParallelSearch(out io.Writer, path string, workers int) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	bounds, err := chunkBounds(file, info.Size(), workers)
+	if err != nil {
+		return err
+	}
+	results := make([]*chunkResult, len(bounds)-1)
+	errs := make([]error, len(bounds)-1)
+	wg := &sync.WaitGroup{}
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			chunk := io.NewSectionReader(file, bounds[i], bounds[i+1]-bounds[i])
+			results[i], errs[i] = searchChunk(chunk)
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	w := bufio.NewWriter(out)
+	w.WriteString("found users:\n")
+	seenBrowsers := make(map[string]struct{}, 200)
+	offset := 0
+	for _, res := range results {
+		for _, u := range res.users {
+			w.WriteByte('[')
+			w.WriteString(strconv.Itoa(offset + u.index))
+			w.WriteString("] ")
+			w.WriteString(u.name)
+			w.WriteString(" <")
+			// SlowSearch заменяет все @, а не только первую
+			w.WriteString(strings.Replace(u.email, "@", " [at] ", -1))
+			w.WriteString(">\n")
+		}
+		for browser := range res.browsers {
+			seenBrowsers[browser] = struct{}{}
+		}
+		offset += res.lines
+	}
+	w.WriteString("\nTotal unique browsers ")
+	w.WriteString(strconv.Itoa(len(seenBrowsers)))
+	w.WriteByte('\n')
+	return w.Flush()
+}
+
+// chunkBounds делит файл на n примерно равных кусков; каждая граница, кроме краев,
+// стоит сразу после перевода строки. Куски могут быть пустыми, если строки длиннее куска
+func chunkBounds(file io.ReaderAt, size int64, n int) ([]int64, error) {
+	bounds := make([]int64, 0, n+1)
+	bounds = append(bounds, 0)
+	buf := make([]byte, 4096)
+	for i := 1; i < n; i++ {
+		pos := size * int64(i) / int64(n)
+		if prev := bounds[len(bounds)-1]; pos < prev {
+			pos = prev
+		}
+		// граница - после первого \n начиная с pos-1, чтобы строка, которая
+		// заканчивается ровно перед pos, осталась в предыдущем куске
+		for pos > 0 && pos < size {
+			read, err := file.ReadAt(buf, pos-1)
+			if nl := bytes.IndexByte(buf[:read], '\n'); nl >= 0 {
+				pos += int64(nl)
+				break
+			}
+			if err == io.EOF {
+				pos = size
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			pos += int64(read)
+		}
+		if pos > size {
+			pos = size
+		}
+		bounds = append(bounds, pos)
+	}
+	return append(bounds, size), nil
+}
+
+type foundUser struct {
+	index       int
+	name, email string
+}
+
+type chunkResult struct {
+	lines    int
+	users    []foundUser
+	browsers map[string]struct{}
+}
+
+var searchFields = map[string]int{"browsers": 0, "name": 1, "email": 2}
+
+// searchChunk ищет пользователей с Android и MSIE в куске; номера строк - от начала куска
+func searchChunk(r io.Reader) (*chunkResult, error) {
+	reader := bufio.NewReaderSize(r, 64*1024)
+	res := &chunkResult{browsers: make(map[string]struct{}, 200)}
+	rec := &queryRecord{values: make([][]string, len(searchFields))}
+	var buf []byte
+	for {
+		line, err := readLine(reader, &buf)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if err == io.EOF && len(line) == 0 {
+			return res, nil
+		}
+		if len(line) > 0 {
+			if err := rec.decode(line, searchFields); err != nil {
+				return nil, err
+			}
+			isAndroid, isMSIE := false, false
+			for _, browser := range rec.values[0] {
+				android, msie := strings.Contains(browser, "Android"), strings.Contains(browser, "MSIE")
+				if !android && !msie {
+					continue
+				}
+				isAndroid = isAndroid || android
+				isMSIE = isMSIE || msie
+				if _, seen := res.browsers[browser]; !seen {
+					// строка указывает в буфер reader - копируем
+					res.browsers[string([]byte(browser))] = struct{}{}
+				}
+			}
+			if isAndroid && isMSIE {
+				res.users = append(res.users, foundUser{
+					index: res.lines,
+					name:  string([]byte(first(rec.values[1]))),
+					email: string([]byte(first(rec.values[2]))),
+				})
+			}
+		}
+		res.lines++
+		if err == io.EOF {
+			return res, nil
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParallelSearch(t *testing.T) {
+	slowOut := new(bytes.Buffer)
+	SlowSearch(slowOut)
+
+	for _, workers := range []int{1, 2, 3, 8, 64, 5000} {
+		out := new(bytes.Buffer)
+		if err := ParallelSearch(out, filePath, workers); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != slowOut.String() {
+			t.Errorf("workers %d: results not match\nGot:\n%v\nExpected:\n%v", workers, out, slowOut)
+		}
+	}
+}
+
+func TestChunkBounds(t *testing.T) {
+	data := "aaa\nbb\n\ncccccccc\nd"
+	for n := 1; n <= 10; n++ {
+		bounds, err := chunkBounds(strings.NewReader(data), int64(len(data)), n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(bounds) != n+1 || bounds[0] != 0 || bounds[n] != int64(len(data)) {
+			t.Fatalf("n %d: bad bounds %v", n, bounds)
+		}
+		for i := 1; i < n; i++ {
+			if bounds[i] < bounds[i-1] || bounds[i] > 0 && bounds[i] < int64(len(data)) && data[bounds[i]-1] != '\n' {
+				t.Errorf("n %d: bound %d not after a newline: %v", n, bounds[i], bounds)
+			}
+		}
+	}
+}
+
+func TestParallelSearchEnlarged(t *testing.T) {
+	path := enlargedDataset(t, 7)
+	single := new(bytes.Buffer)
+	if err := ParallelSearch(single, path, 1); err != nil {
+		t.Fatal(err)
+	}
+	out := new(bytes.Buffer)
+	if err := ParallelSearch(out, path, 6); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != single.String() {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out, single)
+	}
+	// в каждой копии находятся те же пользователи, только со сдвигом номеров
+	original := new(bytes.Buffer)
+	SlowSearch(original)
+	if found, expected := strings.Count(out.String(), "\n["), 7*strings.Count(original.String(), "\n["); found != expected {
+		t.Errorf("expected %d users in enlarged dataset, found %d", expected, found)
+	}
+}
+
+// enlargedDataset пишет во временный файл users.txt, повторенный times раз
+func enlargedDataset(b testing.TB, times int) string {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		b.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "hw3_bench")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { os.RemoveAll(dir) })
+
+	parts := make([][]byte, times)
+	for i := range parts {
+		parts[i] = data
+	}
+	path := filepath.Join(dir, "users.txt")
+	if err := ioutil.WriteFile(path, bytes.Join(parts, []byte("\n")), 0644); err != nil {
+		b.Fatal(err)
+	}
+	return path
+}
+
+// go test -bench Parallel -benchmem
+func BenchmarkParallel(b *testing.B) {
+	path := enlargedDataset(b, 50)
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := ParallelSearch(ioutil.Discard, path, workers); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Язык запросов к логу пользователей, например:
+//	browsers contains "Chrome" and country = "Kenya"
+//	(browsers contains Android or browsers contains iPhone) and not company = Jatri
+// Сравнения: поле = значение, поле != значение, поле contains подстрока.
+// Для поля-массива (browsers) сравнение верно, если подходит хотя бы один элемент,
+// != - если не подходит ни один. Значение - строка в кавычках или слово без пробелов
+
+type Query struct {
+	src  string
+	root queryNode
+	// fields - поля записи, которые нужны запросу, по порядку индексов в queryRecord
+	fields []string
+}
+
+type queryOp int
+
+const (
+	opEq queryOp = iota
+	opNe
+	opContains
+)
+
+type queryNode interface {
+	eval(rec *queryRecord) bool
+}
+
+type andNode struct{ left, right queryNode }
+type orNode struct{ left, right queryNode }
+type notNode struct{ node queryNode }
+
+type cmpNode struct {
+	field int
+	op    queryOp
+	value string
+}
+
+func (n *andNode) eval(rec *queryRecord) bool { return n.left.eval(rec) && n.right.eval(rec) }
+func (n *orNode) eval(rec *queryRecord) bool  { return n.left.eval(rec) || n.right.eval(rec) }
+func (n *notNode) eval(rec *queryRecord) bool { return !n.node.eval(rec) }
+
+func (n *cmpNode) eval(rec *queryRecord) bool {
+	if n.op == opNe {
+		return !n.any(rec, opEq)
+	}
+	return n.any(rec, n.op)
+}
+
+func (n *cmpNode) any(rec *queryRecord, op queryOp) bool {
+	for _, v := range rec.values[n.field] {
+		if op == opEq && v == n.value || op == opContains && strings.Contains(v, n.value) {
+			return true
+		}
+	}
+	return false
+}
+
+// queryRecord - значения полей одной строки лога. Строки указывают прямо в буфер строки
+// и переиспользуются для следующей, поэтому живут только до ее чтения
+type queryRecord struct {
+	values [][]string
+}
+
+func (rec *queryRecord) reset() {
+	for i := range rec.values {
+		rec.values[i] = rec.values[i][:0]
+	}
+}
+
+func (q *Query) String() string {
+	return q.src
+}
+
+// Fields - поля записи, которые использует запрос
+func (q *Query) Fields() []string {
+	return q.fields
+}
+
+func (q *Query) fieldIndex(name string) int {
+	for i, f := range q.fields {
+		if f == name {
+			return i
+		}
+	}
+	q.fields = append(q.fields, name)
+	return len(q.fields) - 1
+}
+
+type queryToken struct {
+	kind  byte // 'w' - слово, 's' - строка в кавычках, 'o' - оператор или скобка, 0 - конец
+	text  string
+	pos   int
+	value string
+}
+
+func tokenizeQuery(src string) ([]queryToken, error) {
+	var tokens []queryToken
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '(' || c == ')' || c == '=':
+			tokens = append(tokens, queryToken{kind: 'o', text: src[i : i+1], pos: i})
+			i++
+		case c == '!':
+			if i+1 >= len(src) || src[i+1] != '=' {
+				return nil, fmt.Errorf("query: unexpected %q at %d", c, i)
+			}
+			tokens = append(tokens, queryToken{kind: 'o', text: "!=", pos: i})
+			i += 2
+		case c == '"':
+			end := i + 1
+			for end < len(src) && src[end] != '"' {
+				if src[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(src) {
+				return nil, fmt.Errorf("query: unterminated string at %d", i)
+			}
+			value, err := strconv.Unquote(src[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("query: bad string at %d: %v", i, err)
+			}
+			tokens = append(tokens, queryToken{kind: 's', text: src[i : end+1], pos: i, value: value})
+			i = end + 1
+		default:
+			end := i
+			for end < len(src) && !strings.ContainsRune(" \t\n()=!\"", rune(src[end])) {
+				end++
+			}
+			tokens = append(tokens, queryToken{kind: 'w', text: src[i:end], pos: i, value: src[i:end]})
+			i = end
+		}
+	}
+	return append(tokens, queryToken{pos: len(src)}), nil
+}
+
+type queryParser struct {
+	q      *Query
+	tokens []queryToken
+	pos    int
+}
+
+// ParseQuery разбирает запрос
+func ParseQuery(src string) (*Query, error) {
+	tokens, err := tokenizeQuery(src)
+	if err != nil {
+		return nil, err
+	}
+	q := &Query{src: src}
+	p := &queryParser{q: q, tokens: tokens}
+	if q.root, err = p.or(); err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != 0 {
+		return nil, p.unexpected(t)
+	}
+	return q, nil
+}
+
+func MustParseQuery(src string) *Query {
+	q, err := ParseQuery(src)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+func (p *queryParser) peek() queryToken {
+	return p.tokens[p.pos]
+}
+
+func (p *queryParser) next() queryToken {
+	t := p.tokens[p.pos]
+	if t.kind != 0 {
+		p.pos++
+	}
+	return t
+}
+
+func (p *queryParser) unexpected(t queryToken) error {
+	if t.kind == 0 {
+		return fmt.Errorf("query: unexpected end of query")
+	}
+	return fmt.Errorf("query: unexpected %s at %d", t.text, t.pos)
+}
+
+func (p *queryParser) keyword(word string) bool {
+	t := p.peek()
+	if t.kind == 'w' && strings.EqualFold(t.text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *queryParser) or() (queryNode, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = &orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) and() (queryNode, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = &andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) unary() (queryNode, error) {
+	if p.keyword("not") {
+		node, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{node}, nil
+	}
+	if t := p.peek(); t.kind == 'o' && t.text == "(" {
+		p.next()
+		node, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.next(); t.kind != 'o' || t.text != ")" {
+			return nil, p.unexpected(t)
+		}
+		return node, nil
+	}
+	return p.cmp()
+}
+
+func (p *queryParser) cmp() (queryNode, error) {
+	field := p.next()
+	if field.kind != 'w' {
+		return nil, p.unexpected(field)
+	}
+	node := &cmpNode{}
+	switch op := p.next(); {
+	case op.kind == 'o' && op.text == "=":
+		node.op = opEq
+	case op.kind == 'o' && op.text == "!=":
+		node.op = opNe
+	case op.kind == 'w' && strings.EqualFold(op.text, "contains"):
+		node.op = opContains
+	default:
+		return nil, p.unexpected(op)
+	}
+	value := p.next()
+	if value.kind != 'w' && value.kind != 's' {
+		return nil, p.unexpected(value)
+	}
+	node.field = p.q.fieldIndex(field.text)
+	node.value = value.value
+	return node, nil
+}
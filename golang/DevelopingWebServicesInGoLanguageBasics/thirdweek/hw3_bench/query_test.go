@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func searchFile(t *testing.T, q *Query) string {
+	file, err := os.Open(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	out := new(bytes.Buffer)
+	if err := q.Search(file, out); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestQueryMatchesSlowSearch(t *testing.T) {
+	slowOut := new(bytes.Buffer)
+	SlowSearch(slowOut)
+	res := searchFile(t, MustParseQuery(`browsers contains "Android" and browsers contains "MSIE"`))
+
+	// списки найденных пользователей совпадают, итоговые строки у поиска по запросу свои
+	slowUsers := slowOut.String()[:strings.Index(slowOut.String(), "\nTotal")]
+	users := res[:strings.Index(res, "\nTotal")]
+	if users != slowUsers {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", users, slowUsers)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	input := `{"name":"Ann","email":"ann@a.com","country":"Kenya","age":30,"browsers":["Chrome/1","MSIE 7.0"]}
+{"name":"Bob","email":"bob@b.com","country":"Peru","age":41,"browsers":["Android 4; Chrome/2"]}
+
+{"name":"Café \"C\"","email":"c@c.com","country":"Kenya","browsers":[]}
+`
+	cases := []struct {
+		query    string
+		expected []string
+	}{
+		{`country = Kenya`, []string{"Ann", `Café "C"`}},
+		{`browsers contains "Chrome" and country = "Kenya"`, []string{"Ann"}},
+		{`browsers contains Chrome or name = "Café \"C\""`, []string{"Ann", "Bob", `Café "C"`}},
+		{`not browsers contains Chrome`, []string{`Café "C"`}},
+		{`browsers != "MSIE 7.0" and (country = Peru or age = 30)`, []string{"Bob"}},
+		{`age = 41`, []string{"Bob"}},
+		{`missing = x OR NOT missing != x`, nil},
+	}
+	for _, c := range cases {
+		out := new(bytes.Buffer)
+		if err := MustParseQuery(c.query).Search(strings.NewReader(input), out); err != nil {
+			t.Fatalf("%s: %v", c.query, err)
+		}
+		var names []string
+		for _, line := range strings.Split(out.String(), "\n") {
+			if strings.HasPrefix(line, "[") {
+				names = append(names, line[strings.Index(line, "] ")+2:strings.Index(line, " <")])
+			}
+		}
+		if strings.Join(names, ",") != strings.Join(c.expected, ",") {
+			t.Errorf("%s: results not match\nGot: %v\nExpected: %v", c.query, names, c.expected)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	for _, src := range []string{
+		``,
+		`browsers contains`,
+		`name = "unterminated`,
+		`(name = a`,
+		`name = a b`,
+		`name ! a`,
+		`= a`,
+		`name like a`,
+	} {
+		if _, err := ParseQuery(src); err == nil {
+			t.Errorf("%q: expected error", src)
+		}
+	}
+}
+
+func TestCLI(t *testing.T) {
+	out := new(bytes.Buffer)
+	err := run([]string{"-file", "-", `country = Kenya`},
+		strings.NewReader(`{"name":"Ann","email":"ann@a.com","country":"Kenya"}`), out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "found users:\n[0] Ann <ann [at] a.com>\n\nTotal found 1\n"; out.String() != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out, expected)
+	}
+	if err := run([]string{"name ="}, nil, ioutil.Discard); err == nil {
+		t.Errorf("expected query error")
+	}
+}
+
+func BenchmarkQuery(b *testing.B) {
+	q := MustParseQuery(`browsers contains "Android" and browsers contains "MSIE"`)
+	for i := 0; i < b.N; i++ {
+		file, err := os.Open(filePath)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := q.Search(file, ioutil.Discard); err != nil {
+			b.Fatal(err)
+		}
+		file.Close()
+	}
+}
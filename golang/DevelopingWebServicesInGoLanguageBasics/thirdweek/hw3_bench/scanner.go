@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+)
+
+// SearchDecoder - чем StreamSearchWith разбирает строки лога
+type SearchDecoder int
+
+const (
+	// EasyJSONDecoder - сгенерированный easyjson разбор в Record
+	EasyJSONDecoder SearchDecoder = iota
+	// ScannerDecoder - userScanner: ищет browsers, email и name прямо в байтах строки, не аллоцируя
+	ScannerDecoder
+)
+
+func (d SearchDecoder) String() string {
+	switch d {
+	case EasyJSONDecoder:
+		return "easyjson"
+	case ScannerDecoder:
+		return "scanner"
+	}
+	return "unknown"
+}
+
+// ParseSearchDecoder - декодер по имени из SearchDecoder.String
+func ParseSearchDecoder(name string) (SearchDecoder, error) {
+	for _, d := range []SearchDecoder{EasyJSONDecoder, ScannerDecoder} {
+		if d.String() == name {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown decoder %q, expected easyjson or scanner", name)
+}
+
+var (
+	androidBytes = []byte("Android")
+	msieBytes    = []byte("MSIE")
+	nullBytes    = []byte("null")
+)
+
+// userScanner разбирает строку лога без аллокаций: значения указывают прямо в строку,
+// а строки с escape-последовательностями раскрываются в scratch
+type userScanner struct {
+	browsers    [][]byte
+	name, email []byte
+	scratch     []byte
+}
+
+func scanError(i int, what string) error {
+	return fmt.Errorf("scanner: %s at offset %d", what, i)
+}
+
+func skipSpace(line []byte, i int) int {
+	for i < len(line) && (line[i] == ' ' || line[i] == '\t' || line[i] == '\r' || line[i] == '\n') {
+		i++
+	}
+	return i
+}
+
+// scan разбирает JSON объект строки; значения живут до следующего вызова
+func (s *userScanner) scan(line []byte) error {
+	s.browsers = s.browsers[:0]
+	s.name, s.email = nil, nil
+	// раскрытая строка не длиннее исходной, так что scratch не переедет посреди строки
+	if cap(s.scratch) < len(line) {
+		s.scratch = make([]byte, 0, len(line))
+	}
+	s.scratch = s.scratch[:0]
+
+	i := skipSpace(line, 0)
+	if i >= len(line) || line[i] != '{' {
+		return scanError(i, "expected {")
+	}
+	i = skipSpace(line, i+1)
+	if i < len(line) && line[i] == '}' {
+		return s.end(line, i+1)
+	}
+	for {
+		key, next, err := s.str(line, i)
+		if err != nil {
+			return err
+		}
+		i = skipSpace(line, next)
+		if i >= len(line) || line[i] != ':' {
+			return scanError(i, "expected :")
+		}
+		i = skipSpace(line, i+1)
+
+		// как и easyjson, null не меняет поле: остается пустым или прежним значением
+		if bytes.HasPrefix(line[i:], nullBytes) {
+			key = nil
+		}
+		switch string(key) {
+		case "browsers":
+			i, err = s.scanBrowsers(line, i)
+		case "name":
+			s.name, i, err = s.str(line, i)
+		case "email":
+			s.email, i, err = s.str(line, i)
+		default:
+			i, err = skipValue(line, i)
+		}
+		if err != nil {
+			return err
+		}
+
+		i = skipSpace(line, i)
+		switch {
+		case i < len(line) && line[i] == ',':
+			i = skipSpace(line, i+1)
+		case i < len(line) && line[i] == '}':
+			return s.end(line, i+1)
+		default:
+			return scanError(i, "expected , or }")
+		}
+	}
+}
+
+func (s *userScanner) end(line []byte, i int) error {
+	if i = skipSpace(line, i); i != len(line) {
+		return scanError(i, "unexpected data after object")
+	}
+	return nil
+}
+
+// scanBrowsers читает массив браузеров; повторный ключ browsers заменяет прежний список
+func (s *userScanner) scanBrowsers(line []byte, i int) (int, error) {
+	if i >= len(line) || line[i] != '[' {
+		return i, scanError(i, "expected browsers array")
+	}
+	s.browsers = s.browsers[:0]
+	i = skipSpace(line, i+1)
+	if i < len(line) && line[i] == ']' {
+		return i + 1, nil
+	}
+	for {
+		browser, next, err := s.str(line, i)
+		if err != nil {
+			return i, err
+		}
+		s.browsers = append(s.browsers, browser)
+		i = skipSpace(line, next)
+		switch {
+		case i < len(line) && line[i] == ',':
+			i = skipSpace(line, i+1)
+		case i < len(line) && line[i] == ']':
+			return i + 1, nil
+		default:
+			return i, scanError(i, "expected , or ]")
+		}
+	}
+}
+
+// str читает строку JSON, начинающуюся с line[i], и возвращает ее значение и позицию за ней
+func (s *userScanner) str(line []byte, i int) ([]byte, int, error) {
+	if i >= len(line) || line[i] != '"' {
+		return nil, i, scanError(i, "expected string")
+	}
+	start := i + 1
+	for j := start; j < len(line); j++ {
+		switch line[j] {
+		case '"':
+			return line[start:j], j + 1, nil
+		case '\\':
+			return s.unescape(line, start)
+		}
+	}
+	return nil, i, scanError(i, "unterminated string")
+}
+
+func (s *userScanner) unescape(line []byte, start int) ([]byte, int, error) {
+	from := len(s.scratch)
+	for j := start; j < len(line); j++ {
+		c := line[j]
+		if c == '"' {
+			return s.scratch[from:], j + 1, nil
+		}
+		if c != '\\' {
+			s.scratch = append(s.scratch, c)
+			continue
+		}
+		j++
+		if j >= len(line) {
+			break
+		}
+		switch line[j] {
+		case '"', '\\', '/':
+			s.scratch = append(s.scratch, line[j])
+		case 'b':
+			s.scratch = append(s.scratch, '\b')
+		case 'f':
+			s.scratch = append(s.scratch, '\f')
+		case 'n':
+			s.scratch = append(s.scratch, '\n')
+		case 'r':
+			s.scratch = append(s.scratch, '\r')
+		case 't':
+			s.scratch = append(s.scratch, '\t')
+		case 'u':
+			r, n := decodeUnicodeEscape(line[j-1:])
+			if n == 0 {
+				return nil, j, scanError(j, "bad unicode escape")
+			}
+			var enc [utf8.UTFMax]byte
+			s.scratch = append(s.scratch, enc[:utf8.EncodeRune(enc[:], r)]...)
+			j += n - 2
+		default:
+			return nil, j, scanError(j, "bad escape")
+		}
+	}
+	return nil, start, scanError(start-1, "unterminated string")
+}
+
+// decodeUnicodeEscape раскрывает \uXXXX (или суррогатную пару) в начале b
+// и возвращает руну и длину escape-последовательности; 0 - ошибка
+func decodeUnicodeEscape(b []byte) (rune, int) {
+	hex := func(b []byte) rune {
+		if len(b) < 6 || b[0] != '\\' || b[1] != 'u' {
+			return -1
+		}
+		var r rune
+		for _, c := range b[2:6] {
+			switch {
+			case c >= '0' && c <= '9':
+				r = r<<4 | rune(c-'0')
+			case c >= 'a' && c <= 'f':
+				r = r<<4 | rune(c-'a'+10)
+			case c >= 'A' && c <= 'F':
+				r = r<<4 | rune(c-'A'+10)
+			default:
+				return -1
+			}
+		}
+		return r
+	}
+	r := hex(b)
+	if r < 0 {
+		return 0, 0
+	}
+	if r >= 0xD800 && r < 0xDC00 {
+		if low := hex(b[6:]); low >= 0xDC00 && low < 0xE000 {
+			return (r-0xD800)<<10 + (low - 0xDC00) + 0x10000, 12
+		}
+		return utf8.RuneError, 6
+	}
+	return r, 6
+}
+
+var errUnexpectedEnd = errors.New("scanner: unexpected end of line")
+
+// skipValue пропускает любое значение JSON, начинающееся с line[i]
+func skipValue(line []byte, i int) (int, error) {
+	if i >= len(line) {
+		return i, errUnexpectedEnd
+	}
+	switch line[i] {
+	case '"':
+		for j := i + 1; j < len(line); j++ {
+			switch line[j] {
+			case '\\':
+				j++
+			case '"':
+				return j + 1, nil
+			}
+		}
+		return i, errUnexpectedEnd
+	case '{', '[':
+		depth := 0
+		for j := i; j < len(line); j++ {
+			switch line[j] {
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+				if depth == 0 {
+					return j + 1, nil
+				}
+			case '"':
+				end, err := skipValue(line, j)
+				if err != nil {
+					return i, err
+				}
+				j = end - 1
+			}
+		}
+		return i, errUnexpectedEnd
+	}
+	// число, true, false или null
+	j := i
+	for j < len(line) && line[j] != ',' && line[j] != '}' && line[j] != ']' &&
+		line[j] != ' ' && line[j] != '\t' && line[j] != '\r' && line[j] != '\n' {
+		j++
+	}
+	if j == i {
+		return i, scanError(i, "expected value")
+	}
+	return j, nil
+}
+
+// match - matchUser для браузеров из scan; в seenBrowsers копируются только новые браузеры
+func (s *userScanner) match(seenBrowsers map[string]struct{}) bool {
+	isAndroid := false
+	isMSIE := false
+
+	for _, browser := range s.browsers {
+		switch {
+		case bytes.Contains(browser, androidBytes):
+			isAndroid = true
+		case bytes.Contains(browser, msieBytes):
+			isMSIE = true
+		default:
+			continue
+		}
+
+		if _, seenBefore := seenBrowsers[string(browser)]; !seenBefore {
+			seenBrowsers[string(browser)] = struct{}{}
+		}
+	}
+	return isAndroid && isMSIE
+}
+
+// writeUserBytes - writeUser для значений из userScanner
+func writeUserBytes(w *bufio.Writer, i int, name, email []byte) {
+	var num [20]byte
+	w.WriteByte('[')
+	w.Write(strconv.AppendInt(num[:0], int64(i), 10))
+	w.WriteString("] ")
+	w.Write(name)
+	w.WriteString(" <")
+	if at := bytes.IndexByte(email, '@'); at >= 0 {
+		w.Write(email[:at])
+		w.WriteString(" [at] ")
+		w.Write(email[at+1:])
+	} else {
+		w.Write(email)
+	}
+	w.WriteString(">\n")
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestScannerDecoder(t *testing.T) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slowOut := new(bytes.Buffer)
+	SlowSearch(slowOut)
+
+	out := new(bytes.Buffer)
+	if err := StreamSearchWith(bytes.NewReader(data), out, ScannerDecoder); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != slowOut.String() {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out, slowOut)
+	}
+
+	// null и повторные ключи сканер должен понимать так же, как easyjson
+	lines := strings.Join([]string{
+		`{"name":null,"email":null,"browsers":["Android","MSIE"]}`,
+		`{"name":"Ann","email":"a@b","name":null,"email":null,"browsers":["Android","MSIE"]}`,
+		`{"name":"Bob","browsers":["Android","MSIE"],"browsers":["Opera"]}`,
+		`{"name":"Cid","browsers":["Opera"],"browsers":["Android 5","MSIE 9"]}`,
+		`{"name":"Dan","browsers":["Android 6","MSIE 10"],"browsers":null}`,
+	}, "\n")
+	easyOut, scannerOut := new(bytes.Buffer), new(bytes.Buffer)
+	if err := StreamSearchWith(strings.NewReader(lines), easyOut, EasyJSONDecoder); err != nil {
+		t.Fatal(err)
+	}
+	if err := StreamSearchWith(strings.NewReader(lines), scannerOut, ScannerDecoder); err != nil {
+		t.Fatal(err)
+	}
+	if scannerOut.String() != easyOut.String() {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", scannerOut, easyOut)
+	}
+}
+
+func TestUserScanner(t *testing.T) {
+	cases := []struct {
+		line     string
+		name     string
+		email    string
+		browsers []string
+	}{
+		{`{"name":"Ann","email":"a@b","browsers":["Android","MSIE"]}`, "Ann", "a@b", []string{"Android", "MSIE"}},
+		{` { "browsers" : [ ] , "name" : "Bob" } `, "Bob", "", nil},
+		{`{"name":"A\"n\\n\/","browsers":null}`, `A"n\n/`, "", nil},
+		{`{"name":"Жé😀","email":"x@y"}`, "Жé😀", "x@y", nil},
+		{`{"job":{"a":[1,"}]",{"b":null}]},"age":-1.5e3,"ok":true,"name":"Cid","phone":"\"}"}`, "Cid", "", nil},
+		{`{"browsers":["Mozilla \"MSIE\"","Opera\tAndroid"]}`, "", "", []string{`Mozilla "MSIE"`, "Opera\tAndroid"}},
+		{`{}`, "", "", nil},
+		{`{"name":null,"email":null}`, "", "", nil},
+		{`{"name":"Ann","name":null,"email":"a@b","email":null}`, "Ann", "a@b", nil},
+		{`{"browsers":["Android"],"browsers":["MSIE","Opera"]}`, "", "", []string{"MSIE", "Opera"}},
+		{`{"browsers":["Android"],"browsers":null}`, "", "", []string{"Android"}},
+	}
+	s := &userScanner{}
+	for _, c := range cases {
+		if err := s.scan([]byte(c.line)); err != nil {
+			t.Errorf("%s: %v", c.line, err)
+			continue
+		}
+		if string(s.name) != c.name || string(s.email) != c.email {
+			t.Errorf("%s: got name %q email %q", c.line, s.name, s.email)
+		}
+		if len(s.browsers) != len(c.browsers) {
+			t.Errorf("%s: got browsers %q", c.line, s.browsers)
+			continue
+		}
+		for i := range c.browsers {
+			if string(s.browsers[i]) != c.browsers[i] {
+				t.Errorf("%s: got browsers %q", c.line, s.browsers)
+			}
+		}
+	}
+
+	for _, line := range []string{
+		``,
+		`[]`,
+		`{"name":`,
+		`{"name":"Ann"`,
+		`{"name":"Ann}`,
+		`{"name" "Ann"}`,
+		`{"name":"Ann",}`,
+		`{"name":"A\x"}`,
+		`{"name":"\u12"}`,
+		`{"browsers":"Android"}`,
+		`{"browsers":["Android" "MSIE"]}`,
+		`{"job":{"a":1}`,
+		`{"name":"Ann"} x`,
+	} {
+		if err := s.scan([]byte(line)); err == nil {
+			t.Errorf("%s: expected error", line)
+		}
+	}
+}
+
+func TestUserScannerAllocs(t *testing.T) {
+	line := []byte(`{"browsers":["Mozilla/5.0 (Linux; Android 4.4.2)","MSIE 8.0","Opera"],"company":"X","email":"a@b.c","name":"Ann"}`)
+	seen := make(map[string]struct{})
+	s := &userScanner{}
+	// первый проход заводит scratch, слайс браузеров и браузеры в seen
+	s.scan(line)
+	s.match(seen)
+	allocs := testing.AllocsPerRun(100, func() {
+		if err := s.scan(line); err != nil {
+			t.Fatal(err)
+		}
+		if !s.match(seen) {
+			t.Fatal("expected match")
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("scan and match allocate %v times per line", allocs)
+	}
+}
+
+func TestCLIDecoder(t *testing.T) {
+	input := `{"name":"Ann","email":"a@b","browsers":["Android","MSIE"]}`
+	expected := "found users:\n[0] Ann <a [at] b>\n\nTotal unique browsers 2\n"
+	for _, name := range []string{"easyjson", "scanner"} {
+		out := new(bytes.Buffer)
+		if err := run([]string{"-file", "-", "-decoder", name}, strings.NewReader(input), out); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != expected {
+			t.Errorf("%s: results not match\nGot:\n%v\nExpected:\n%v", name, out, expected)
+		}
+	}
+	if err := run([]string{"-decoder", "gson"}, strings.NewReader(""), ioutil.Discard); err == nil {
+		t.Errorf("expected unknown decoder error")
+	}
+}
+
+// go test -bench Decoders -benchmem
+func BenchmarkDecoders(b *testing.B) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Run("slow", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			SlowSearch(ioutil.Discard)
+		}
+	})
+	for _, decoder := range []SearchDecoder{EasyJSONDecoder, ScannerDecoder} {
+		decoder := decoder
+		b.Run(decoder.String(), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := StreamSearchWith(bytes.NewReader(data), ioutil.Discard, decoder); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
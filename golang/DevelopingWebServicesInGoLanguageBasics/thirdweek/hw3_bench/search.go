@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/mailru/easyjson/jlexer"
+)
+
+// Search печатает пользователей из in (JSON на строку), подходящих под запрос,
+// в формате FastSearch. Строки читаются и разбираются по одной, в памяти держится только текущая
+func (q *Query) Search(in io.Reader, out io.Writer) error {
+	reader := bufio.NewReaderSize(in, 64*1024)
+	w := bufio.NewWriter(out)
+
+	// кроме полей запроса, для вывода нужны имя и email
+	index := make(map[string]int, len(q.fields)+2)
+	for i, f := range q.fields {
+		index[f] = i
+	}
+	nameIdx, emailIdx := addField(index, "name"), addField(index, "email")
+	rec := &queryRecord{values: make([][]string, len(index))}
+
+	var buf []byte
+	found := 0
+	fmt.Fprintln(w, "found users:")
+	for i := 0; ; i++ {
+		line, err := readLine(reader, &buf)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if len(line) > 0 {
+			if decodeErr := rec.decode(line, index); decodeErr != nil {
+				return fmt.Errorf("line %d: %v", i, decodeErr)
+			}
+			if q.root.eval(rec) {
+				found++
+				writeUser(w, i, first(rec.values[nameIdx]), first(rec.values[emailIdx]))
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	fmt.Fprintln(w, "\nTotal found", found)
+	return w.Flush()
+}
+
+func addField(index map[string]int, name string) int {
+	if i, ok := index[name]; ok {
+		return i
+	}
+	index[name] = len(index)
+	return len(index) - 1
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// writeUser печатает пользователя, как FastSearch: "[i] name <user [at] domain>"
+func writeUser(w *bufio.Writer, i int, name, email string) {
+	var num [20]byte
+	w.WriteByte('[')
+	w.Write(strconv.AppendInt(num[:0], int64(i), 10))
+	w.WriteString("] ")
+	w.WriteString(name)
+	w.WriteString(" <")
+	if at := strings.IndexByte(email, '@'); at >= 0 {
+		w.WriteString(email[:at])
+		w.WriteString(" [at] ")
+		w.WriteString(email[at+1:])
+	} else {
+		w.WriteString(email)
+	}
+	w.WriteString(">\n")
+}
+
+// readLine читает строку без '\n', в том числе последнюю без перевода строки.
+// Длинные строки собираются в *buf, короткие возвращаются прямо из буфера reader
+func readLine(reader *bufio.Reader, buf *[]byte) ([]byte, error) {
+	line, err := reader.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		*buf = append((*buf)[:0], line...)
+		for err == bufio.ErrBufferFull {
+			line, err = reader.ReadSlice('\n')
+			*buf = append(*buf, line...)
+		}
+		line = *buf
+	}
+	if len(line) > 0 && line[len(line)-1] == '\n' {
+		line = line[:len(line)-1]
+	}
+	return line, err
+}
+
+// decode достает из строки значения полей index; остальные поля пропускаются
+func (rec *queryRecord) decode(line []byte, index map[string]int) error {
+	rec.reset()
+	in := jlexer.Lexer{Data: line}
+	in.Delim('{')
+	for !in.IsDelim('}') {
+		key := in.UnsafeFieldName(false)
+		in.WantColon()
+		idx, ok := index[key]
+		switch {
+		case !ok || in.IsNull():
+			in.SkipRecursive()
+		case in.IsDelim('['):
+			in.Delim('[')
+			for !in.IsDelim(']') {
+				rec.values[idx] = append(rec.values[idx], in.UnsafeString())
+				in.WantComma()
+			}
+			in.Delim(']')
+		default:
+			rec.values[idx] = append(rec.values[idx], scalar(in.Raw()))
+		}
+		in.WantComma()
+	}
+	in.Delim('}')
+	in.Consumed()
+	return in.Error()
+}
+
+// scalar - строка как есть, числа и true/false - их текстом
+func scalar(raw []byte) string {
+	if len(raw) > 0 && raw[0] == '"' {
+		in := jlexer.Lexer{Data: raw}
+		return in.UnsafeString()
+	}
+	return string(raw)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestStreamSearch(t *testing.T) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slowOut := new(bytes.Buffer)
+	SlowSearch(slowOut)
+
+	out := new(bytes.Buffer)
+	if err := StreamSearch(bytes.NewReader(data), out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != slowOut.String() {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out, slowOut)
+	}
+}
+
+func TestStreamSearchEdges(t *testing.T) {
+	// у второго пользователя нет браузеров - браузеры первого не должны ему достаться,
+	// а последняя строка без перевода строки тоже разбирается
+	input := `{"name":"Ann","email":"ann@a.com","browsers":["Android 4","MSIE 7"]}
+{"name":"Bob","email":"bob@b.com"}
+
+{"name":"Cid","email":"cid@c.com","browsers":["MSIE 8","Android 5"]}`
+	out := new(bytes.Buffer)
+	if err := StreamSearch(strings.NewReader(input), out); err != nil {
+		t.Fatal(err)
+	}
+	expected := "found users:\n[0] Ann <ann [at] a.com>\n[3] Cid <cid [at] c.com>\n\nTotal unique browsers 4\n"
+	if out.String() != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out, expected)
+	}
+
+	if err := StreamSearch(strings.NewReader(`{"name":`), ioutil.Discard); err == nil {
+		t.Errorf("expected decode error")
+	}
+}
+
+func TestCLIStdin(t *testing.T) {
+	out := new(bytes.Buffer)
+	err := run([]string{"-file", "-"}, strings.NewReader(`{"name":"Ann","email":"a@b","browsers":["Android","MSIE"]}`), out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "found users:\n[0] Ann <a [at] b>\n\nTotal unique browsers 2\n"; out.String() != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out, expected)
+	}
+}
+
+// repeatReader отдает data times раз через перевод строки, не держа все копии в памяти
+type repeatReader struct {
+	data  []byte
+	times int
+	r     *bytes.Reader
+}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	for r.r == nil || r.r.Len() == 0 {
+		if r.times == 0 {
+			return 0, io.EOF
+		}
+		r.times--
+		if r.times > 0 {
+			r.r = bytes.NewReader(r.data)
+		} else {
+			// последняя копия - без перевода строки, как сам users.txt
+			r.r = bytes.NewReader(r.data[:len(r.data)-1])
+		}
+	}
+	return r.r.Read(p)
+}
+
+// go test -bench Stream -benchmem
+func BenchmarkStream(b *testing.B) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		b.Fatal(err)
+	}
+	data = append(data, '\n')
+	for _, times := range []int{1, 10} {
+		times := times
+		b.Run(fmt.Sprintf("times=%d", times), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := StreamSearch(&repeatReader{data: data, times: times}, ioutil.Discard); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}